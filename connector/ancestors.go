@@ -0,0 +1,74 @@
+package connector
+
+import "cloud.google.com/go/datastore"
+
+// KeyPart is one level of an ancestor path, e.g. {Kind: "Org", ID: "bq"}
+type KeyPart struct {
+	Kind string
+	ID   string
+}
+
+// AncestorKey builds the key of the last part nested under the previous ones. The key func
+// set with WithKeyFunc only applies to the connector entity ids, not to ancestors.
+func (c *connection) AncestorKey(ancestors []KeyPart) (key *datastore.Key) {
+	for _, part := range ancestors {
+		key = datastore.NameKey(part.Kind, part.ID, key)
+		key.Namespace = c.config.namespace
+	}
+	return
+}
+
+func (c *connection) childKey(kind, entityID string, ancestors []KeyPart) (key *datastore.Key, err error) {
+	if key, err = c.validKey(kind, entityID); err == nil {
+		key.Parent = c.AncestorKey(ancestors)
+	}
+	return
+}
+
+// SaveWithAncestors saves entity as entityID nested under the ancestors path
+func (d *datastoreConnector) SaveWithAncestors(ancestors []KeyPart, entityID string, entity interface{}) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	inboundKey, err := d.childKey(d.CollectionName, entityID, ancestors)
+	if err != nil {
+		return
+	}
+	key, err = d.save(inboundKey, entity)
+	return
+}
+
+// RetrieveWithAncestors loads the entityID nested under the ancestors path into dst
+func (d *datastoreConnector) RetrieveWithAncestors(ancestors []KeyPart, entityID string, dst interface{}) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, entityID)
+	defer d.track("retrieve", d.CollectionName, entityID)()
+	inboundKey, err := d.childKey(d.CollectionName, entityID, ancestors)
+	if err != nil {
+		return
+	}
+	err = d.get(inboundKey, dst)
+	return
+}
+
+// DeleteWithAncestors deletes the entityID nested under the ancestors path
+func (d *datastoreConnector) DeleteWithAncestors(ancestors []KeyPart, entityID string) (err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, entityID)
+	defer d.track("delete", d.CollectionName, entityID)()
+	inboundKey, err := d.childKey(d.CollectionName, entityID, ancestors)
+	if err != nil {
+		return
+	}
+	err = d.client().Delete(d.ctx, inboundKey)
+	return
+}
+
+// QueryWithAncestor runs query restricted to the descendants of ancestor into dst.
+// Ancestor queries are strongly consistent, they see every write committed before they run.
+func (d *datastoreConnector) QueryWithAncestor(ancestor *datastore.Key, query *datastore.Query, dst interface{}) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	if err = d.checkNamespace([]*datastore.Key{ancestor}); err != nil {
+		return
+	}
+	_, err = d.getAll(d.ctx, query.Ancestor(ancestor), dst)
+	return
+}
@@ -0,0 +1,152 @@
+package connector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// BatchWriter buffers entities and saves them in batches when flushSize entities are
+// queued or flushInterval elapses, whichever comes first. Add blocks while a batch is
+// being written so producers can not outrun datastore.
+type BatchWriter struct {
+	connector *datastoreConnector
+	flushSize int
+
+	mu        sync.Mutex
+	entityIDs []string
+	keys      []*datastore.Key
+	entities  []interface{}
+	err       error
+	closed    bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBatchWriter creates a BatchWriter over the connector collection. flushSize is capped
+// at 500 entities and a zero flushInterval disables the periodic flush.
+func (d *datastoreConnector) NewBatchWriter(flushSize int, flushInterval time.Duration) *BatchWriter {
+	if flushSize <= 0 || flushSize > maxBatchSize {
+		flushSize = maxBatchSize
+	}
+
+	w := &BatchWriter{
+		connector: d,
+		flushSize: flushSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if flushInterval > 0 {
+		go w.loop(flushInterval)
+	} else {
+		close(w.done)
+	}
+
+	return w
+}
+
+// Add queues entity, a pointer to struct, to be saved as entityID. Invalid ids are rejected
+// without queueing the entity, errors from a periodic flush are reported by the next call.
+func (w *BatchWriter) Add(entityID string, entity interface{}) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if err = w.takeErr(); err != nil {
+		return
+	}
+
+	key, err := w.connector.validKey(w.connector.CollectionName, entityID)
+	if err != nil {
+		wrapErr(&err, "add", w.connector.CollectionName, entityID)
+		return
+	}
+	w.entityIDs = append(w.entityIDs, entityID)
+	w.keys = append(w.keys, key)
+	w.entities = append(w.entities, w.connector.adapt(entity))
+	if len(w.keys) >= w.flushSize {
+		err = w.flush()
+	}
+
+	return
+}
+
+// Flush writes the queued entities. A failed batch is dropped from the queue and its error is
+// an UnsavedBatchError listing the ids of the entities that were not saved.
+func (w *BatchWriter) Flush() (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err = w.takeErr(); err != nil {
+		return
+	}
+	err = w.flush()
+	return
+}
+
+// Close flushes the queued entities and stops the periodic flush
+func (w *BatchWriter) Close() (err error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	err = errors.Join(w.takeErr(), w.flush())
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return
+}
+
+func (w *BatchWriter) loop(flushInterval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			// the queue is kept until the pending error, and the ids it lists, is reported
+			if w.err == nil {
+				w.err = w.flush()
+			}
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// flush must be called with w.mu held
+func (w *BatchWriter) flush() (err error) {
+	defer wrapErr(&err, "save batch", w.connector.CollectionName, "")
+	defer w.connector.track("save batch", w.connector.CollectionName, "")()
+	if len(w.keys) == 0 {
+		return
+	}
+
+	release := w.connector.acquire()
+	if _, err = w.connector.client().PutMulti(w.connector.ctx, w.keys, w.entities); err == nil {
+		w.connector.wrote(w.keys...)
+	} else {
+		err = &UnsavedBatchError{EntityIDs: w.entityIDs, err: err}
+	}
+	release()
+	w.entityIDs, w.keys, w.entities = nil, nil, nil
+	return
+}
+
+func (w *BatchWriter) takeErr() (err error) {
+	err, w.err = w.err, nil
+	return
+}
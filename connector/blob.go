@@ -0,0 +1,23 @@
+package connector
+
+import "cloud.google.com/go/datastore"
+
+// blobEntity stores raw bytes unindexed, indexed byte strings are limited to 1500 bytes
+type blobEntity struct {
+	Data []byte `datastore:",noindex"`
+}
+
+// SaveBlob saves data as the single unindexed Data property of entityID
+func (d *datastoreConnector) SaveBlob(entityID string, data []byte) (*datastore.Key, error) {
+	return d.Save(entityID, &blobEntity{Data: data})
+}
+
+// RetrieveBlob returns the data saved with SaveBlob
+func (d *datastoreConnector) RetrieveBlob(entityID string) (data []byte, err error) {
+	var blob blobEntity
+	if err = d.Retrieve(entityID, &blob); err != nil {
+		return
+	}
+	data = blob.Data
+	return
+}
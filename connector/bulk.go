@@ -0,0 +1,173 @@
+package connector
+
+import (
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/datastore"
+)
+
+// maxBatchSize is the maximum number of entities datastore accepts in a single write
+const maxBatchSize = 500
+
+// forEachChunk calls fn with consecutive [start, end) ranges of at most size items
+func forEachChunk(n, size int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachChunk runs the chunks holding a slot of the WithMaxConcurrency limit for each of them
+func (c *connection) forEachChunk(n, size int, fn func(start, end int) error) error {
+	if c.sem == nil {
+		return forEachChunk(n, size, fn)
+	}
+	return forEachChunk(n, size, func(start, end int) error {
+		defer c.acquire()()
+		return fn(start, end)
+	})
+}
+
+// acquire waits for a slot of the WithMaxConcurrency limit and returns the func releasing it,
+// every batch request of the bulk operations must hold one
+func (c *connection) acquire() (release func()) {
+	if c.sem == nil {
+		return func() {}
+	}
+	c.sem <- struct{}{}
+	return func() { <-c.sem }
+}
+
+// SaveAll saves every entity of the map under its id, writing in batches of 500.
+// The keys are returned sorted by entity id.
+func (d *datastoreConnector) SaveAll(entities map[string]interface{}) (keys []*datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, "")
+	defer d.track("save", d.CollectionName, "")()
+
+	entityIDs := make([]string, 0, len(entities))
+	for entityID := range entities {
+		entityIDs = append(entityIDs, entityID)
+	}
+	sort.Strings(entityIDs)
+
+	src := make([]interface{}, len(entityIDs))
+	for i, entityID := range entityIDs {
+		src[i] = entities[entityID]
+	}
+
+	keys, err = d.saveMulti(entityIDs, src)
+	return
+}
+
+// SaveMulti saves entities[i] under entityIDs[i], writing in batches of 500. It fails with a
+// DuplicateKeysError before writing anything when several entities map to the same key.
+func (d *datastoreConnector) SaveMulti(entityIDs []string, entities []interface{}) (keys []*datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, "")
+	defer d.track("save", d.CollectionName, "")()
+	if len(entityIDs) != len(entities) {
+		return nil, fmt.Errorf("connector: %d ids for %d entities", len(entityIDs), len(entities))
+	}
+	keys, err = d.saveMulti(entityIDs, entities)
+	return
+}
+
+func (d *datastoreConnector) saveMulti(entityIDs []string, entities []interface{}) (keys []*datastore.Key, err error) {
+	keys = make([]*datastore.Key, len(entityIDs))
+	src := make([]interface{}, len(entityIDs))
+	seen := make(map[string]bool, len(entityIDs))
+	var duplicates []string
+	for i, entityID := range entityIDs {
+		if keys[i], err = d.validKey(d.CollectionName, entityID); err != nil {
+			return nil, err
+		}
+		// the key func may map different ids to the same key
+		if seen[keys[i].Name] {
+			duplicates = append(duplicates, entityID)
+		}
+		seen[keys[i].Name] = true
+		src[i] = d.adapt(entities[i])
+	}
+	if len(duplicates) > 0 {
+		return nil, &DuplicateKeysError{EntityIDs: duplicates}
+	}
+
+	err = d.forEachChunk(len(keys), maxBatchSize, func(start, end int) (err error) {
+		if _, err = d.client().PutMulti(d.ctx, keys[start:end], src[start:end]); err == nil {
+			d.wrote(keys[start:end]...)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// UpsertMulti saves every entity of the map under its id and counts how many were created and
+// how many replaced a stored one. The existence check and the writes are not transactional,
+// the counts may be off when the same ids are written concurrently.
+func (d *datastoreConnector) UpsertMulti(entities map[string]interface{}) (created, updated int, err error) {
+	defer wrapErr(&err, "upsert", d.CollectionName, "")
+	defer d.track("upsert", d.CollectionName, "")()
+
+	entityIDs := make([]string, 0, len(entities))
+	for entityID := range entities {
+		entityIDs = append(entityIDs, entityID)
+	}
+	sort.Strings(entityIDs)
+
+	keys := make([]*datastore.Key, len(entityIDs))
+	src := make([]interface{}, len(entityIDs))
+	for i, entityID := range entityIDs {
+		if keys[i], err = d.validKey(d.CollectionName, entityID); err != nil {
+			return 0, 0, err
+		}
+		src[i] = entities[entityID]
+	}
+
+	err = d.forEachChunk(len(keys), maxBatchSize, func(start, end int) (err error) {
+		dst := make([]interface{}, end-start)
+		for i := range dst {
+			dst[i] = &discard{}
+		}
+		err = d.client().GetMulti(d.ctx, keys[start:end], dst)
+		multiErr, isMulti := err.(datastore.MultiError)
+		if err != nil && !isMulti {
+			return
+		}
+		for i := range dst {
+			switch {
+			case !isMulti || multiErr[i] == nil:
+				updated++
+			case multiErr[i] == datastore.ErrNoSuchEntity:
+				created++
+			default:
+				return multiErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err = d.saveMulti(entityIDs, src); err != nil {
+		return 0, 0, err
+	}
+	return
+}
+
+// discard loads an entity without keeping any property, for existence checks
+type discard struct{}
+
+func (discard) Load([]datastore.Property) error { return nil }
+
+func (discard) Save() ([]datastore.Property, error) { return nil, nil }
@@ -0,0 +1,55 @@
+package connector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"cloud.google.com/go/datastore"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func compressProperty(name string) propertyTransform {
+	return func(props datastore.PropertyList) (datastore.PropertyList, error) {
+		for i := range props {
+			data, ok := props[i].Value.([]byte)
+			if props[i].Name != name || !ok {
+				continue
+			}
+
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(data); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			props[i].Value = buf.Bytes()
+			props[i].NoIndex = true
+		}
+		return props, nil
+	}
+}
+
+func decompressProperty(name string) propertyTransform {
+	return func(props datastore.PropertyList) (datastore.PropertyList, error) {
+		for i := range props {
+			data, ok := props[i].Value.([]byte)
+			if props[i].Name != name || !ok || !bytes.HasPrefix(data, gzipMagic) {
+				continue
+			}
+
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("decompress %s: %w", name, err)
+			}
+			if props[i].Value, err = ioutil.ReadAll(zr); err != nil {
+				return nil, fmt.Errorf("decompress %s: %w", name, err)
+			}
+		}
+		return props, nil
+	}
+}
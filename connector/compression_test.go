@@ -0,0 +1,69 @@
+package connector
+
+import (
+	"bytes"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestCompressPropertyRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), 100)
+	props := datastore.PropertyList{
+		{Name: "Body", Value: append([]byte(nil), data...)},
+		{Name: "Other", Value: []byte("left alone")},
+		{Name: "Count", Value: int64(3)},
+	}
+
+	props, err := compressProperty("Body")(props)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	body := props[0].Value.([]byte)
+	if !bytes.HasPrefix(body, gzipMagic) || len(body) >= len(data) || !props[0].NoIndex {
+		t.Errorf("got %d bytes, want %d bytes gzipped and unindexed", len(body), len(data))
+	}
+	if string(props[1].Value.([]byte)) != "left alone" || props[2].Value != int64(3) {
+		t.Errorf("other properties changed: %v", props[1:])
+	}
+
+	if props, err = decompressProperty("Body")(props); err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !bytes.Equal(props[0].Value.([]byte), data) {
+		t.Errorf("got %q back, want the original data", props[0].Value)
+	}
+}
+
+func TestDecompressProperty(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    interface{}
+		invalid bool
+	}{
+		{name: "uncompressed bytes", value: []byte("stored before compression"), want: []byte("stored before compression")},
+		{name: "not bytes", value: "text", want: "text"},
+		{name: "broken gzip", value: append(append([]byte(nil), gzipMagic...), 0, 1, 2), invalid: true},
+	}
+	for _, test := range tests {
+		props, err := decompressProperty("Body")(datastore.PropertyList{{Name: "Body", Value: test.value}})
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", test.name, props)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got, ok := props[0].Value.([]byte); ok {
+			if !bytes.Equal(got, test.want.([]byte)) {
+				t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+			}
+		} else if props[0].Value != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, props[0].Value, test.want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// maxEntityIDLength is the maximum size in bytes of a key name
+const maxEntityIDLength = 1500
+
+// emulatorProjectID is used on emulator connections without a project
+const emulatorProjectID = "connector-emulator"
+
+// clientCloseDelay is how long a client replaced by Reconnect or SetCredentials stays open, so
+// the requests already running on it can finish
+const clientCloseDelay = time.Minute
+
+// connectorConfig keeps the factory arguments so the datastore client can be built again
+type connectorConfig struct {
+	emulatorEnable        bool
+	datastoreEmulatorAddr string
+	gcloudCredentialsPath string
+	projectID             string
+	emulatorTLS           bool
+	emulatorTLSConfig     *tls.Config
+	missingAsNil          bool
+	ctx                   context.Context
+	keyFunc               func(id string) string
+	counterAttempts       func(entityID string, attempts int)
+	namespace             string
+	insertOnly            bool
+	endpoint              string
+	userAgent             string
+	slowOpThreshold       time.Duration
+	slowOpHook            func(op, key string, took time.Duration)
+	tokenSource           oauth2.TokenSource
+	saveTransforms        []propertyTransform
+	loadTransforms        []propertyTransform
+	retryPolicy           func(err error) bool
+	maxEntitySize         int
+	eventualConsistency   bool
+	hotKeyWindow          time.Duration
+	negativeCacheSize     int
+	negativeCacheTTL      time.Duration
+	strictProjectCheck    bool
+	jsonFields            bool
+	keyfileOptional       bool
+	maxConcurrency        int
+	labels                map[string]string
+	operationHook         func(op Operation)
+	idGenerator           func() string
+	keyPrefix             string
+	keySeparator          string
+}
+
+func newConnectorConfig(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID string, opts []Option) (config connectorConfig) {
+	config = connectorConfig{
+		emulatorEnable:        emulatorEnable,
+		datastoreEmulatorAddr: datastoreEmulatorAddr,
+		gcloudCredentialsPath: gcloudCredentialsPath,
+		projectID:             projectID,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	// on GCP the project can be read from the environment or the metadata server, newClient
+	// replaces it with the keyfile or the emulator project when there is one
+	if config.projectID == "" {
+		config.projectID = datastore.DetectProjectID
+	}
+	return
+}
+
+// connection holds the datastore client shared by basic and atomic connectors.
+// It is safe for concurrent use: ctx and config are not changed after construction, except
+// config.tokenSource which SetCredentials replaces together with the client under mu. Both
+// are only read under mu, through client and copies of config. connectMu serializes the
+// reconnects so none of them builds its client from a config another one is replacing.
+type connection struct {
+	mu         sync.RWMutex
+	connectMu  sync.Mutex
+	dsClient   *datastore.Client
+	ctx        context.Context
+	config     connectorConfig
+	clientType datatoreClientType
+	hotKeys    *hotKeyTracker
+	missing    *negativeCache
+	sem        chan struct{}
+}
+
+// clientOptions returns the client options set through Option for non emulator clients
+func (config connectorConfig) clientOptions() (opts []option.ClientOption) {
+	if config.endpoint != "" {
+		opts = append(opts, option.WithEndpoint(config.endpoint))
+	}
+	if config.userAgent != "" {
+		opts = append(opts, option.WithUserAgent(config.userAgent))
+	}
+	if config.tokenSource != nil {
+		opts = append(opts, option.WithTokenSource(config.tokenSource))
+	}
+	return
+}
+
+func newConnection(config connectorConfig) (conn *connection, err error) {
+	conn = &connection{
+		ctx:        config.ctx,
+		config:     config,
+		clientType: getClientType(config.emulatorEnable, config.gcloudCredentialsPath),
+	}
+	if conn.ctx == nil {
+		conn.ctx = context.Background()
+	}
+	if config.hotKeyWindow > 0 {
+		conn.hotKeys = newHotKeyTracker(config.hotKeyWindow)
+	}
+	if config.maxConcurrency > 0 {
+		conn.sem = make(chan struct{}, config.maxConcurrency)
+	}
+	if config.negativeCacheSize > 0 {
+		conn.missing = newNegativeCache(config.negativeCacheSize, config.negativeCacheTTL)
+	}
+	// the detected project is kept, a reconnect with SetCredentials credentials could not read
+	// it from the keyfile again
+	conn.dsClient, conn.config.projectID, err = newClient(conn.ctx, conn.config, conn.clientType)
+	return
+}
+
+// newClient builds the datastore client for config and returns the project it is for, the
+// keyfile or emulator one when config asks to detect it
+func newClient(ctx context.Context, config connectorConfig, clientType datatoreClientType) (client *datastore.Client, projectID string, err error) {
+	projectID = config.projectID
+	// credentials set with SetCredentials replace the keyfile ones
+	if clientType == KEYFILE && config.tokenSource != nil {
+		clientType = SIMPLE
+	}
+
+	switch clientType {
+	case EMULATOR:
+		// the emulator address is passed to the client rather than set in DATASTORE_EMULATOR_HOST,
+		// a process wide variable would leak into every other client of the process
+		transport := grpc.WithInsecure()
+		if config.emulatorTLS {
+			transport = grpc.WithTransportCredentials(credentials.NewTLS(config.emulatorTLSConfig))
+		}
+		// the client only detects the emulator project from DATASTORE_EMULATOR_HOST, which is
+		// not set, and any project is accepted by the emulator
+		if projectID == datastore.DetectProjectID {
+			if projectID = os.Getenv("DATASTORE_PROJECT_ID"); projectID == "" {
+				projectID = emulatorProjectID
+			}
+		}
+		client, err = datastore.NewClient(
+			ctx,
+			projectID,
+			option.WithEndpoint(config.datastoreEmulatorAddr),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(transport),
+		)
+
+		break
+	case SIMPLE:
+		client, err = datastore.NewClient(ctx, projectID, config.clientOptions()...)
+
+		break
+	case KEYFILE:
+
+		jsonKey, err := ioutil.ReadFile(path.Join(config.gcloudCredentialsPath, "keyfile.json"))
+
+		if os.IsNotExist(err) && config.keyfileOptional {
+			// application default credentials, e.g. gcloud auth on a developer machine
+			client, err = datastore.NewClient(ctx, projectID, config.clientOptions()...)
+			return client, projectID, err
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if projectID, err = keyfileProject(jsonKey, config); err != nil {
+			return nil, "", err
+		}
+
+		conf, err := google.JWTConfigFromJSON(
+			jsonKey,
+			datastore.ScopeDatastore,
+		)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		// the token source refreshes the token for the whole client life, it must not stop
+		// working when the connector context is cancelled
+		tokenSource := oauth2.ReuseTokenSource(nil, conf.TokenSource(context.Background()))
+		client, err = datastore.NewClient(
+			ctx,
+			projectID,
+			append(config.clientOptions(), option.WithTokenSource(tokenSource))...,
+		)
+		return client, projectID, err
+	default:
+		err = errUnknownClient
+		break
+	}
+
+	return
+}
+
+// keyfileProject returns the project the client is built for, the keyfile one when the
+// connector has none. The client cannot detect it, the keyfile only reaches it as a token
+// source. A mismatch with the connector project is logged unless WithStrictProjectCheck
+// makes it an error.
+func keyfileProject(jsonKey []byte, config connectorConfig) (projectID string, err error) {
+	var keyfile struct {
+		ProjectID string `json:"project_id"`
+	}
+	if err = json.Unmarshal(jsonKey, &keyfile); err != nil {
+		return
+	}
+	if config.projectID == datastore.DetectProjectID && keyfile.ProjectID != "" {
+		return keyfile.ProjectID, nil
+	}
+	if keyfile.ProjectID == "" || keyfile.ProjectID == config.projectID {
+		return config.projectID, nil
+	}
+
+	err = fmt.Errorf("%w: keyfile of %q used for %q", ErrProjectMismatch, keyfile.ProjectID, config.projectID)
+	if config.strictProjectCheck {
+		return "", err
+	}
+	log.Printf("connector: %v", err)
+	return config.projectID, nil
+}
+
+func (c *connection) client() *datastore.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dsClient
+}
+
+// IsEmulator reports whether the connector talks to the datastore emulator
+func (c *connection) IsEmulator() bool {
+	return c.clientType == EMULATOR
+}
+
+// Reconnect replaces the underlying datastore client with a new one built from the stored
+// config, the old client is closed once clientCloseDelay has passed
+func (c *connection) Reconnect() (err error) {
+	defer wrapErr(&err, "reconnect", c.config.projectID, "")
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	c.mu.RLock()
+	config := c.config
+	c.mu.RUnlock()
+	err = c.connect(config)
+	return
+}
+
+// SetCredentials replaces the client with one authenticated by ts without recreating the
+// connector, later reconnects keep using ts. It has no effect on emulator connections.
+func (c *connection) SetCredentials(ts oauth2.TokenSource) (err error) {
+	defer wrapErr(&err, "set credentials", c.config.projectID, "")
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
+	c.mu.RLock()
+	config := c.config
+	c.mu.RUnlock()
+	config.tokenSource = ts
+	err = c.connect(config)
+	return
+}
+
+// connect swaps the client for a new one built from config, which is kept for later reconnects.
+// It must be called with connectMu held.
+func (c *connection) connect(config connectorConfig) (err error) {
+	client, _, err := newClient(c.ctx, config, c.clientType)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	old := c.dsClient
+	c.dsClient = client
+	c.config.tokenSource = config.tokenSource
+	c.mu.Unlock()
+
+	// the old client is usually broken at this point, its close error adds nothing. Requests
+	// that took it before the swap get clientCloseDelay to finish.
+	if old != nil {
+		time.AfterFunc(clientCloseDelay, func() { old.Close() })
+	}
+
+	return
+}
+
+// Warmup sends a cheap query so the gRPC connection is established before the first request
+func (c *connection) Warmup(ctx context.Context) (err error) {
+	defer wrapErr(&err, "warmup", c.config.projectID, "")
+	if _, err = c.client().Run(ctx, datastore.NewQuery("__namespace__").KeysOnly().Limit(1)).Next(nil); err == iterator.Done {
+		err = nil
+	}
+	return
+}
+
+func (c *connection) nameKey(kind, entityID string) *datastore.Key {
+	if c.config.keyFunc != nil {
+		entityID = c.config.keyFunc(entityID)
+	}
+	key := datastore.NameKey(kind, entityID, nil)
+	key.Namespace = c.config.namespace
+	return key
+}
+
+// validKey builds the entity key and rejects ids datastore reserves or does not accept
+func (c *connection) validKey(kind, entityID string) (key *datastore.Key, err error) {
+	key = c.nameKey(kind, entityID)
+	if err = validateEntityID(key.Name); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// checkNamespace rejects keys outside the namespace set with WithNamespace, so a raw key
+// cannot reach another tenant. Without a namespace every key is accepted.
+func (c *connection) checkNamespace(keys []*datastore.Key) error {
+	if c.config.namespace == "" {
+		return nil
+	}
+	for _, key := range keys {
+		for k := key; k != nil; k = k.Parent {
+			if k.Namespace != c.config.namespace {
+				return fmt.Errorf("%w: key %v is in namespace %q, not %q", ErrNamespaceMismatch, key, k.Namespace, c.config.namespace)
+			}
+		}
+	}
+	return nil
+}
+
+func validateEntityID(entityID string) error {
+	switch {
+	case entityID == "":
+		return fmt.Errorf("%w: empty id", ErrInvalidEntityID)
+	case strings.HasPrefix(entityID, "__"):
+		return fmt.Errorf("%w: %q starts with the reserved prefix __", ErrInvalidEntityID, entityID)
+	case len(entityID) > maxEntityIDLength:
+		return fmt.Errorf("%w: id is longer than %d bytes", ErrInvalidEntityID, maxEntityIDLength)
+	}
+	return nil
+}
+
+// Operation is a finished connector operation as reported to the WithOperationHook hook
+type Operation struct {
+	Name   string
+	Key    string
+	Took   time.Duration
+	Labels map[string]string
+}
+
+// track measures an operation and reports it to the hooks, it is meant to be deferred:
+// defer d.track("save", d.CollectionName, entityID)()
+func (c *connection) track(op, kind, entityID string) func() {
+	return c.trackLabeled(op, kind, entityID, nil)
+}
+
+// trackLabeled is track for an operation with labels on top of the connector ones
+func (c *connection) trackLabeled(op, kind, entityID string, labels map[string]string) func() {
+	if c.config.slowOpHook == nil && c.config.operationHook == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		took := time.Since(start)
+		key := kind
+		if entityID != "" {
+			key = kind + "/" + entityID
+		}
+		if c.config.slowOpHook != nil && took >= c.config.slowOpThreshold {
+			c.config.slowOpHook(op, key, took)
+		}
+		if c.config.operationHook != nil {
+			c.config.operationHook(Operation{Name: op, Key: key, Took: took, Labels: mergeLabels(c.config.labels, labels)})
+		}
+	}
+}
+
+// mergeLabels returns a new map with the labels of base overridden by extra
+func mergeLabels(base, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(extra))
+	for name, value := range base {
+		merged[name] = value
+	}
+	for name, value := range extra {
+		merged[name] = value
+	}
+	return merged
+}
+
+// wrote is called with the keys every successful write saved
+func (c *connection) wrote(keys ...*datastore.Key) {
+	if c.hotKeys != nil {
+		c.hotKeys.record(keys)
+	}
+	if c.missing != nil {
+		c.missing.invalidate(keys)
+	}
+}
+
+// runInTransaction runs f in a transaction that datastore retries on contention, once the
+// retries are exhausted the concurrency failure is wrapped so it matches both ErrConflict and
+// datastore.ErrConcurrentTransaction
+func (c *connection) runInTransaction(f func(t *datastore.Transaction) error, opts ...datastore.TransactionOption) (commit *datastore.Commit, err error) {
+	commit, err = c.client().RunInTransaction(c.ctx, f, opts...)
+	if errors.Is(err, datastore.ErrConcurrentTransaction) {
+		err = fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return
+}
+
+func existInTransaction(t *datastore.Transaction, key *datastore.Key) (exist bool, err error) {
+	var stored datastore.PropertyList
+	if err = t.Get(key, &stored); err == datastore.ErrNoSuchEntity {
+		return false, nil
+	}
+	exist = err == nil
+	return
+}
@@ -0,0 +1,97 @@
+package connector_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bq/datastore/connector"
+	"github.com/bq/datastore/connector/testutil"
+	"golang.org/x/oauth2"
+)
+
+type sharedEntity struct {
+	Worker int
+	Step   int
+}
+
+// concurrencyWorkers and concurrencySteps size the concurrent tests, run them with go test -race
+const (
+	concurrencyWorkers = 8
+	concurrencySteps   = 20
+)
+
+func TestConcurrentUse(t *testing.T) {
+	conn, addr, cleanup := testutil.StartEmulator(t, "Shared")
+	defer cleanup()
+	counters := connector.NewAtomicConnector(true, addr, "", testutil.EmulatorProjectID, "SharedCounter")
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrencyWorkers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for step := 0; step < concurrencySteps; step++ {
+				if _, err := conn.Save("shared", &sharedEntity{Worker: worker, Step: step}); err != nil {
+					t.Errorf("Save: %v", err)
+				}
+				var entity sharedEntity
+				if err := conn.Retrieve("shared", &entity); err != nil {
+					t.Errorf("Retrieve: %v", err)
+				}
+				if _, err := counters.IncrementCounter("hits", 1); err != nil {
+					t.Errorf("IncrementCounter: %v", err)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	amount, err := counters.Count("hits")
+	if err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if want := concurrencyWorkers * concurrencySteps; amount != want {
+		t.Errorf("Count: got %d, want %d", amount, want)
+	}
+}
+
+func TestConcurrentReconnect(t *testing.T) {
+	conn, _, cleanup := testutil.StartEmulator(t, "Shared")
+	defer cleanup()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrencyWorkers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for step := 0; step < concurrencySteps; step++ {
+				// a replaced client stays open for the requests already running on it
+				if _, err := conn.Save("shared", &sharedEntity{Worker: worker, Step: step}); err != nil {
+					t.Errorf("Save: %v", err)
+				}
+				var entity sharedEntity
+				if err := conn.Retrieve("shared", &entity); err != nil {
+					t.Errorf("Retrieve: %v", err)
+				}
+			}
+		}(worker)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for step := 0; step < concurrencySteps; step++ {
+			if err := conn.Reconnect(); err != nil {
+				t.Errorf("Reconnect: %v", err)
+			}
+			if err := conn.SetCredentials(ts); err != nil {
+				t.Errorf("SetCredentials: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	if _, err := conn.Save("shared", &sharedEntity{}); err != nil {
+		t.Errorf("Save after reconnecting: %v", err)
+	}
+}
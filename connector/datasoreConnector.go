@@ -2,14 +2,16 @@ package connector
 
 import (
 	"context"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"log"
-	"os"
-	"path"
+	"reflect"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/datastore"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iterator"
 )
 
 type datatoreClientType int
@@ -47,98 +49,220 @@ func getClientType(emulatorEnable bool, gcloudCredentialsPath string) (clientTyp
 }
 
 type datastoreConnector struct {
-	client         *datastore.Client
-	ctx            context.Context
+	*connection
 	CollectionName string
+	labels         map[string]string
 }
 
 // DatastoreBasicOpt represents datastore basic operations as CRUD methods
 type DatastoreBasicOpt interface {
 	Save(entityID string, entity interface{}) (*datastore.Key, error)
+	SaveEntity(entity interface{}) (*datastore.Key, error)
+	SaveGenerated(entity interface{}) (string, *datastore.Key, error)
+	SaveIfVersion(entityID string, entity interface{}, expectedVersion int) (bool, error)
+	EstimateSize(entity interface{}) (int, error)
 	SaveAutoID(entity interface{}) (*datastore.Key, error)
+	SaveAll(entities map[string]interface{}) ([]*datastore.Key, error)
+	SaveWithExcludedIndexes(entityID string, entity interface{}, exclude []string) (*datastore.Key, error)
+	SaveMulti(entityIDs []string, entities []interface{}) ([]*datastore.Key, error)
+	SaveProperties(entityID string, props datastore.PropertyList, unindexed []string) (*datastore.Key, error)
+	SaveBlob(entityID string, data []byte) (*datastore.Key, error)
 	Exist(query *datastore.Query) bool
+	CountByDay(field string, from, to time.Time) (map[string]int, error)
 	Delete(entityID string) bool
+	DeleteExisting(entityID string) (bool, error)
+	StreamDelete(query *datastore.Query) (int, error)
+	DeleteByQueryBounded(query *datastore.Query, maxDuration time.Duration) (int, bool, error)
+	Truncate(concurrency int) (int, error)
+	DeleteIf(entityID string, predicate func(dst interface{}) bool) (bool, error)
 	Update(entityID string, entity interface{}) (*datastore.Key, error)
+	Upsert(entityID string, entity interface{}) (bool, *datastore.Key, error)
+	Mutate(entityID string, mutate func(dst interface{}) error, dst interface{}) error
+	UpsertMulti(entities map[string]interface{}) (int, int, error)
+	SaveAndRetrieve(entityID string, entity interface{}, dst interface{}) error
 	Retrieve(entityID string, dst interface{}) error
-	RetrieveByQuery(dst interface{}, query *datastore.Query) error
-	RetrieveByQueryWithKeys(dst interface{}, query *datastore.Query) ([]*datastore.Key, error)
+	RetrieveOrDefault(entityID string, dst interface{}, def interface{}) error
+	RetrieveWithRepair(entityID string, dst interface{}, repair func(dst interface{}) (bool, error)) error
+	RetrieveField(entityID, field string, dst interface{}) error
+	RetrieveBlob(entityID string) ([]byte, error)
+	RetrieveOrdered(entityIDs []string, dst interface{}, onMissing func(id string)) error
+	Resolve(refs []string, targetKind string, dst interface{}) error
+	RetrieveByKeys(keys []*datastore.Key, dst interface{}) error
+	RetrieveByKeysWhere(keys []*datastore.Key, query *datastore.Query, dst interface{}) error
+	QueryKeysRaw(query *datastore.Query) ([]*datastore.Key, error)
+	DeleteKeys(keys []*datastore.Key) error
+	UpdateKeys(keys []*datastore.Key, update func(key *datastore.Key, entity *datastore.PropertyList) error) error
+	Query() *datastore.Query
+	NewQueryBuilder() *QueryBuilder
+	Explain(query *datastore.Query) (ExplainMetrics, error)
+	RetrieveByQuery(dst interface{}, query *datastore.Query, opts ...QueryOption) error
+	RetrieveByQueryWithKeys(dst interface{}, query *datastore.Query, opts ...QueryOption) ([]*datastore.Key, error)
+	RetrieveModifiedSince(field string, since time.Time, dst interface{}) error
+	RetrieveByQueryPartial(dst interface{}, query *datastore.Query, timeout time.Duration) (bool, error)
+	FindOne(query *datastore.Query, dst interface{}) error
+	QueryInto(query *datastore.Query, sliceType reflect.Type) (interface{}, error)
+	QueryToMap(query *datastore.Query, dst interface{}) error
+	QueryAcrossNamespaces(namespaces []string, query *datastore.Query, dst interface{}) error
+	Stream(ctx context.Context, query *datastore.Query) (<-chan Result, <-chan error)
+	StreamWithCancel(query *datastore.Query) (<-chan Result, <-chan error, func())
+	StreamJSON(ctx context.Context, query *datastore.Query, w io.Writer) error
+	ReadInto(ctx context.Context, query *datastore.Query, out chan<- interface{}, decode func() interface{}) error
+	NewBatchWriter(flushSize int, flushInterval time.Duration) *BatchWriter
+	ImportRecords(records []Record) ([]ImportResult, error)
+	ListIDs() ([]string, error)
+	Properties() ([]string, error)
+	CopyTo(targetKind string, transform func(dst interface{}) interface{}) (int, error)
+	Scan(cursor string, batchSize int, fn func(key *datastore.Key, decode func(dst interface{}) error) error, opts ...ScanOption) (string, bool, error)
+	Transaction(f func(tx *Tx) error) error
+	ReadOnlyTransaction(f func(tx *datastore.Transaction) error) error
+	AncestorKey(ancestors []KeyPart) *datastore.Key
+	SaveWithAncestors(ancestors []KeyPart, entityID string, entity interface{}) (*datastore.Key, error)
+	RetrieveWithAncestors(ancestors []KeyPart, entityID string, dst interface{}) error
+	DeleteWithAncestors(ancestors []KeyPart, entityID string) error
+	QueryWithAncestor(ancestor *datastore.Key, query *datastore.Query, dst interface{}) error
+	Warmup(ctx context.Context) error
+	WaitForEmulator(ctx context.Context, timeout time.Duration) error
+	HotKeys(threshold float64) []string
+	Reconnect() error
+	SetCredentials(ts oauth2.TokenSource) error
+	IsEmulator() bool
+	ComposeID(parts ...string) (string, error)
+	ParseID(entityID string) []string
+	Labeled(labels map[string]string) DatastoreBasicOpt
 }
 
-// New is a factory method that create new datastore connector single instances
-func New(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID, CollectionName string) DatastoreBasicOpt {
+// New is a factory method that create new datastore connector single instances.
+// An empty projectID is detected from the environment or the application default credentials.
+func New(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID, CollectionName string, opts ...Option) DatastoreBasicOpt {
 	var Instance = new(datastoreConnector)
 	Instance.CollectionName = CollectionName
-	Instance.ctx = context.Background()
 	var err error
-	switch getClientType(emulatorEnable, gcloudCredentialsPath) {
-	case EMULATOR:
-		os.Setenv("DATASTORE_EMULATOR_HOST", datastoreEmulatorAddr)
-		if Instance.client, err = datastore.NewClient(Instance.ctx, projectID); err != nil {
-			log.Fatal(err)
-		}
+	config := newConnectorConfig(emulatorEnable, datastoreEmulatorAddr, gcloudCredentialsPath, projectID, opts)
+	if Instance.connection, err = newConnection(config); err != nil {
+		log.Fatal(err)
+	}
 
-		break
-	case SIMPLE:
-		client, err := datastore.NewClient(Instance.ctx, projectID)
+	return Instance
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+// Labeled returns a connector sharing the client of d whose operations are reported to the
+// WithOperationHook hook with labels added, e.g. the product feature they are run for
+func (d *datastoreConnector) Labeled(labels map[string]string) DatastoreBasicOpt {
+	return &datastoreConnector{connection: d.connection, CollectionName: d.CollectionName, labels: mergeLabels(d.labels, labels)}
+}
 
-		Instance.client = client
-		break
-	case KEYFILE:
+func (d *datastoreConnector) track(op, kind, entityID string) func() {
+	return d.trackLabeled(op, kind, entityID, d.labels)
+}
 
-		jsonKey, err := ioutil.ReadFile(path.Join(gcloudCredentialsPath, "keyfile.json"))
+func (d *datastoreConnector) SaveAutoID(entity interface{}) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, "")
+	defer d.track("save", d.CollectionName, "")()
+	k := datastore.IncompleteKey(d.CollectionName, nil)
+	k.Namespace = d.config.namespace
+	if key, err = d.client().Put(d.ctx, k, d.adapt(entity)); err == nil {
+		d.wrote(key)
+	}
+	return
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+func (d *datastoreConnector) Save(entityID string, entity interface{}) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	key, err = d.saveID(entityID, entity)
+	return
+}
 
-		conf, err := google.JWTConfigFromJSON(
-			jsonKey,
-			datastore.ScopeDatastore,
-		)
+// saveID is Save without the error wrapping and tracking, for the methods doing their own
+func (d *datastoreConnector) saveID(entityID string, entity interface{}) (key *datastore.Key, err error) {
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	return d.save(inboundKey, entity)
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+func (d *datastoreConnector) save(inboundKey *datastore.Key, entity interface{}) (key *datastore.Key, err error) {
+	return d.write(inboundKey, d.adapt(entity))
+}
 
-		client, err := datastore.NewClient(
-			Instance.ctx,
-			projectID,
-			option.WithTokenSource(conf.TokenSource(Instance.ctx)),
-		)
+// write saves entity as it is, honouring WithInsertOnly
+func (d *datastoreConnector) write(inboundKey *datastore.Key, entity interface{}) (key *datastore.Key, err error) {
+	if d.config.insertOnly {
+		key, err = d.insert(inboundKey, entity)
+	} else {
+		key, err = d.client().Put(d.ctx, inboundKey, entity)
+	}
+	if err == nil {
+		d.wrote(key)
+	}
+	return
+}
 
+// insert writes entity only when key is not stored yet
+func (d *datastoreConnector) insert(inboundKey *datastore.Key, entity interface{}) (key *datastore.Key, err error) {
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		exist, err := existInTransaction(t, inboundKey)
 		if err != nil {
-			log.Fatal(err)
+			return
 		}
+		if exist {
+			return ErrAlreadyExists
+		}
+		_, err = t.Put(inboundKey, entity)
+		return
+	})
 
-		Instance.client = client
-		break
-	default:
-		log.Fatal("Unknown Datastore client")
-		break
+	if err == nil {
+		key = inboundKey
 	}
 
-	return Instance
+	return
 }
 
-func (d *datastoreConnector) SaveAutoID(entity interface{}) (key *datastore.Key, err error) {
-	k := datastore.IncompleteKey(d.CollectionName, nil)
-	key, err = d.client.Put(d.ctx, k, entity)
+// SaveProperties saves a dynamic entity, the properties named in unindexed are not indexed
+func (d *datastoreConnector) SaveProperties(entityID string, props datastore.PropertyList, unindexed []string) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	props = withNoIndex(props, unindexed)
+	key, err = d.saveID(entityID, &props)
 	return
 }
 
-func (d *datastoreConnector) Save(entityID string, entity interface{}) (key *datastore.Key, err error) {
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	key, err = d.client.Put(d.ctx, inboundKey, entity)
+// SaveWithExcludedIndexes saves entity with the named properties unindexed for this write only,
+// whatever its struct tags say. The save transforms run once, when the properties are saved.
+func (d *datastoreConnector) SaveWithExcludedIndexes(entityID string, entity interface{}, exclude []string) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	props, err := d.config.properties(entity)
+	if err != nil {
+		return
+	}
+	props = withNoIndex(props, exclude)
+	key, err = d.saveID(entityID, &props)
 	return
 }
 
+// withNoIndex returns a copy of props with the properties named in unindexed not indexed
+func withNoIndex(props datastore.PropertyList, unindexed []string) datastore.PropertyList {
+	noIndex := make(map[string]bool, len(unindexed))
+	for _, name := range unindexed {
+		noIndex[name] = true
+	}
+
+	props = append(datastore.PropertyList(nil), props...)
+	for i := range props {
+		if noIndex[props[i].Name] {
+			props[i].NoIndex = true
+		}
+	}
+	return props
+}
+
 func (d *datastoreConnector) Exist(query *datastore.Query) (exist bool) {
+	defer d.track("exist", d.CollectionName, "")()
 	exist = false
-	if amount, err := d.client.Count(d.ctx, query); err == nil {
+	if amount, err := d.client().Count(d.ctx, d.prepareQuery(query)); err == nil {
 		if amount > 0 {
 			exist = true
 		}
@@ -146,33 +270,405 @@ func (d *datastoreConnector) Exist(query *datastore.Query) (exist bool) {
 	return
 }
 
+// Delete deletes entityID and reports whether the delete succeeded, deleting a missing entity
+// succeeds too. Use DeleteExisting to know whether the entity existed.
 func (d *datastoreConnector) Delete(entityID string) (deleted bool) {
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	if err := d.client.Delete(d.ctx, inboundKey); err != nil {
+	defer d.track("delete", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	if err = d.client().Delete(d.ctx, inboundKey); err == nil {
 		deleted = true
 	}
 
 	return
 }
 
+// DeleteExisting deletes entityID and reports whether it was stored, the check and the delete
+// run in the same transaction
+func (d *datastoreConnector) DeleteExisting(entityID string) (existed bool, err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, entityID)
+	defer d.track("delete", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		if existed, err = existInTransaction(t, inboundKey); err != nil || !existed {
+			return
+		}
+		return t.Delete(inboundKey)
+	})
+
+	if err != nil {
+		existed = false
+	}
+
+	return
+}
+
+// DeleteIf deletes the entity only when predicate accepts its stored version. The entity is
+// read in the same transaction as the delete and handed to predicate as a *datastore.PropertyList.
+func (d *datastoreConnector) DeleteIf(entityID string, predicate func(dst interface{}) bool) (deleted bool, err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, entityID)
+	defer d.track("delete", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		deleted = false
+		var stored datastore.PropertyList
+		if err = t.Get(inboundKey, &stored); err == datastore.ErrNoSuchEntity {
+			return ErrNotFound
+		} else if err != nil {
+			return
+		}
+
+		if !predicate(&stored) {
+			return
+		}
+		if err = t.Delete(inboundKey); err == nil {
+			deleted = true
+		}
+		return
+	})
+
+	if err != nil {
+		deleted = false
+	}
+
+	return
+}
+
+// Update overwrites an existing entity, it returns ErrNotFound instead of creating a missing one
 func (d *datastoreConnector) Update(entityID string, entity interface{}) (key *datastore.Key, err error) {
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	key, err = d.client.Put(d.ctx, inboundKey, entity)
+	defer wrapErr(&err, "update", d.CollectionName, entityID)
+	defer d.track("update", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		exist, err := existInTransaction(t, inboundKey)
+		if err != nil {
+			return
+		}
+		if !exist {
+			return ErrNotFound
+		}
+		_, err = t.Put(inboundKey, d.adapt(entity))
+		return
+	})
+
+	if err == nil {
+		key = inboundKey
+		d.wrote(key)
+	}
+
+	return
+}
+
+// Upsert saves entity and reports whether it was created rather than overwritten
+func (d *datastoreConnector) Upsert(entityID string, entity interface{}) (created bool, key *datastore.Key, err error) {
+	defer wrapErr(&err, "upsert", d.CollectionName, entityID)
+	defer d.track("upsert", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		exist, err := existInTransaction(t, inboundKey)
+		if err != nil {
+			return
+		}
+		created = !exist
+		_, err = t.Put(inboundKey, d.adapt(entity))
+		return
+	})
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	key = inboundKey
+	d.wrote(key)
+	return
+}
+
+// SaveAndRetrieve saves entity and loads into dst the entity read back from datastore once the
+// write is committed. The read is strongly consistent, but a writer that saves entityID in the
+// meantime wins, dst then holds its version.
+func (d *datastoreConnector) SaveAndRetrieve(entityID string, entity interface{}, dst interface{}) (err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	if _, err = d.write(inboundKey, d.adapt(entity)); err != nil {
+		return
+	}
+	// a transaction reads its snapshot and not its own writes, so the entity is read after
+	// the commit
+	err = d.client().Get(d.ctx, inboundKey, d.adapt(dst))
 	return
 }
 
 func (d *datastoreConnector) Retrieve(entityID string, dst interface{}) (err error) {
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	err = d.client.Get(d.ctx, inboundKey, dst)
+	defer wrapErr(&err, "retrieve", d.CollectionName, entityID)
+	defer d.track("retrieve", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	err = d.get(inboundKey, dst)
+	return
+}
+
+// RetrieveOrDefault loads entityID into dst or, when it does not exist, copies def into dst.
+// def is a value or a pointer of the type dst points to.
+func (d *datastoreConnector) RetrieveOrDefault(entityID string, dst interface{}, def interface{}) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, entityID)
+	defer d.track("retrieve", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	if err = d.client().Get(d.ctx, inboundKey, d.adapt(dst)); err != datastore.ErrNoSuchEntity {
+		return
+	}
+
+	target, value := reflect.ValueOf(dst), reflect.Indirect(reflect.ValueOf(def))
+	if target.Kind() != reflect.Ptr || target.IsNil() || !value.IsValid() || value.Type() != target.Elem().Type() {
+		return fmt.Errorf("connector: default %T does not match %T", def, dst)
+	}
+	target.Elem().Set(value)
+	return nil
+}
+
+// RetrieveWithRepair loads entityID into dst and hands it to repair, when repair returns true
+// the fixed dst is saved in the same transaction as the read
+func (d *datastoreConnector) RetrieveWithRepair(entityID string, dst interface{}, repair func(dst interface{}) (bool, error)) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, entityID)
+	defer d.track("retrieve", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	repaired := false
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		if err = t.Get(inboundKey, d.adapt(dst)); err != nil {
+			return
+		}
+		if repaired, err = repair(dst); err != nil || !repaired {
+			return
+		}
+		_, err = t.Put(inboundKey, d.adapt(dst))
+		return
+	})
+	if err == nil && repaired {
+		d.wrote(inboundKey)
+	}
+	return
+}
+
+// Mutate reads entityID into dst, applies mutate and saves dst in one transaction, which is
+// run again from a fresh read on contention. It returns ErrNotFound for a missing entity and
+// saves nothing when mutate fails.
+func (d *datastoreConnector) Mutate(entityID string, mutate func(dst interface{}) error, dst interface{}) (err error) {
+	defer wrapErr(&err, "mutate", d.CollectionName, entityID)
+	defer d.track("mutate", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		zeroValue(dst)
+		if err = t.Get(inboundKey, d.adapt(dst)); err == datastore.ErrNoSuchEntity {
+			return ErrNotFound
+		} else if err != nil {
+			return
+		}
+		if err = mutate(dst); err != nil {
+			return
+		}
+		_, err = t.Put(inboundKey, d.adapt(dst))
+		return
+	})
+	if err == nil {
+		d.wrote(inboundKey)
+	}
+	return
+}
+
+func (d *datastoreConnector) get(inboundKey *datastore.Key, dst interface{}) (err error) {
+	if d.missing != nil && d.missing.missing(inboundKey) {
+		err = datastore.ErrNoSuchEntity
+	} else if err = d.client().Get(d.ctx, inboundKey, d.adapt(dst)); err == datastore.ErrNoSuchEntity && d.missing != nil {
+		d.missing.add(inboundKey)
+	}
+	if err == datastore.ErrNoSuchEntity && d.config.missingAsNil {
+		zeroValue(dst)
+		err = nil
+	}
+	return
+}
+
+// RetrieveOrdered loads entityIDs into dst, a slice of the same length, keeping the requested order.
+// Missing entities are left as zero values and reported to onMissing.
+func (d *datastoreConnector) RetrieveOrdered(entityIDs []string, dst interface{}, onMissing func(id string)) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, "")
+	defer d.track("retrieve", d.CollectionName, "")()
+	keys := make([]*datastore.Key, len(entityIDs))
+	for i, entityID := range entityIDs {
+		keys[i] = d.nameKey(d.CollectionName, entityID)
+	}
+
+	err = d.client().GetMulti(d.ctx, keys, d.adaptMulti(dst))
+	multiErr, ok := err.(datastore.MultiError)
+	if !ok {
+		return
+	}
+
+	err = nil
+	for i, entryErr := range multiErr {
+		switch entryErr {
+		case nil:
+		case datastore.ErrNoSuchEntity:
+			if onMissing != nil {
+				onMissing(entityIDs[i])
+			}
+		default:
+			err = multiErr
+		}
+	}
+
 	return
 }
 
-func (d *datastoreConnector) RetrieveByQuery(dst interface{}, query *datastore.Query) (err error) {
-	_, err = d.client.GetAll(d.ctx, query, dst)
+func (d *datastoreConnector) RetrieveByQuery(dst interface{}, query *datastore.Query, opts ...QueryOption) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	_, err = d.getAll(d.ctx, d.prepareQuery(query, opts...), dst)
 	return
 }
 
-func (d *datastoreConnector) RetrieveByQueryWithKeys(dst interface{}, query *datastore.Query) (keys []*datastore.Key, err error) {
-	keys, err = d.client.GetAll(d.ctx, query, dst)
+func (d *datastoreConnector) RetrieveByQueryWithKeys(dst interface{}, query *datastore.Query, opts ...QueryOption) (keys []*datastore.Key, err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	keys, err = d.getAll(d.ctx, d.prepareQuery(query, opts...), dst)
 	return
 }
+
+// FindOne loads the first entity matching query into dst, it returns ErrNotFound when nothing matches
+func (d *datastoreConnector) FindOne(query *datastore.Query, dst interface{}) (err error) {
+	defer wrapErr(&err, "find", d.CollectionName, "")
+	defer d.track("find", d.CollectionName, "")()
+	if _, err = d.client().Run(d.ctx, d.prepareQuery(query.Limit(1))).Next(d.adapt(dst)); err == iterator.Done {
+		err = ErrNotFound
+	}
+	return
+}
+
+// QueryInto runs query into a new slice of sliceType, e.g. reflect.TypeOf([]Entity{}), and returns it
+func (d *datastoreConnector) QueryInto(query *datastore.Query, sliceType reflect.Type) (result interface{}, err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	if sliceType == nil || sliceType.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("connector: QueryInto needs a slice type, got %v", sliceType)
+	}
+
+	dst := reflect.New(sliceType)
+	if _, err = d.getAll(d.ctx, d.prepareQuery(query), dst.Interface()); err != nil {
+		return
+	}
+	result = dst.Elem().Interface()
+	return
+}
+
+// QueryToMap runs query into dst, a pointer to a map[string]Entity or map[string]*Entity,
+// keyed by the id of every result. A nil map is allocated.
+func (d *datastoreConnector) QueryToMap(query *datastore.Query, dst interface{}) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Map || v.Elem().Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("connector: QueryToMap needs a pointer to a map keyed by string, got %T", dst)
+	}
+
+	m := v.Elem()
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	elemType := m.Type().Elem()
+	it := d.client().Run(d.ctx, d.prepareQuery(query))
+	for {
+		elem := newElem(elemType)
+		key, err := it.Next(d.adapt(elem.Interface()))
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if elemType.Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		m.SetMapIndex(reflect.ValueOf(keyID(key)).Convert(m.Type().Key()), elem)
+	}
+}
+
+// QueryAcrossNamespaces runs query in every namespace and appends all the results to dst, it is
+// the only query that leaves the namespace set with WithNamespace
+func (d *datastoreConnector) QueryAcrossNamespaces(namespaces []string, query *datastore.Query, dst interface{}) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	for _, namespace := range namespaces {
+		if _, err = d.getAll(d.ctx, d.querySettings(query.Namespace(namespace)), dst); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+	}
+	return
+}
+
+// ListIDs returns the id of every entity in the collection using a keys only query.
+// Entities saved with SaveAutoID are listed by their numeric id.
+func (d *datastoreConnector) ListIDs() (ids []string, err error) {
+	defer wrapErr(&err, "list", d.CollectionName, "")
+	defer d.track("list", d.CollectionName, "")()
+	it := d.client().Run(d.ctx, d.prepareQuery(d.Query().KeysOnly()))
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, keyID(key))
+	}
+}
+
+// ReadOnlyTransaction runs f in a read-only transaction so every read sees the same snapshot
+func (d *datastoreConnector) ReadOnlyTransaction(f func(tx *datastore.Transaction) error) (err error) {
+	defer wrapErr(&err, "read-only transaction", d.CollectionName, "")
+	defer d.track("read-only transaction", d.CollectionName, "")()
+	_, err = d.runInTransaction(f, datastore.ReadOnly)
+	return
+}
+
+func keyID(key *datastore.Key) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return strconv.FormatInt(key.ID, 10)
+}
+
+func zeroValue(dst interface{}) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
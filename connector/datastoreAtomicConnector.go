@@ -2,14 +2,12 @@ package connector
 
 import (
 	"context"
-	"io/ioutil"
+	"fmt"
 	"log"
-	"os"
-	"path"
+	"time"
 
 	"cloud.google.com/go/datastore"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
+	"golang.org/x/oauth2"
 )
 
 type BasicCounter struct {
@@ -17,15 +15,29 @@ type BasicCounter struct {
 }
 
 type datastoreAtomicConnector struct {
-	client         *datastore.Client
-	ctx            context.Context
+	*connection
 	CollectionName string
 }
 
 type DatastoreAtomicOpt interface {
-	Count(entityID string) int
-	DecrementCounter(entityID string, decrementAmount int) bool
-	IncrementCounter(entityID string, incrementAmount int) bool
+	Count(entityID string) (int, error)
+	HotKeys(threshold float64) []string
+	CountMultiOrZero(entityIDs []string) (map[string]int, error)
+	DecrementCounter(entityID string, decrementAmount int) (bool, error)
+	IncrementCounter(entityID string, incrementAmount int) (bool, error)
+	InitCounter(entityID string, initial int) (bool, error)
+	IncrementCounterMulti(increments map[string]int) error
+	IncrementCounterApprox(entityID string, incrementAmount int) error
+	IncrementCounterIfBelow(entityID string, incrementAmount, limit int) (bool, int, error)
+	TransferCounter(fromID, toID string, amount int) (bool, error)
+	IncrementTimeBucket(name string, t time.Time, g Granularity, loc *time.Location, incrementAmount int) (bool, error)
+	Warmup(ctx context.Context) error
+	WaitForEmulator(ctx context.Context, timeout time.Duration) error
+	Reconnect() error
+	SetCredentials(ts oauth2.TokenSource) error
+	IsEmulator() bool
+	ComposeID(parts ...string) (string, error)
+	ParseID(entityID string) []string
 }
 
 // NewAtomicConnector is a factory method that create new datastoreAtomicConnector single instances. This connector run all operations in transaction mode.
@@ -36,121 +48,320 @@ type DatastoreAtomicOpt interface {
 // Commit method is invoked. To ensure consistency, reads must be performed by
 // using Transaction's Get method or by using the Transaction method when
 // building a query.
-func NewAtomicConnector(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID, CollectionName string) DatastoreAtomicOpt {
+func NewAtomicConnector(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID, CollectionName string, opts ...Option) DatastoreAtomicOpt {
 	var Instance = new(datastoreAtomicConnector)
 	Instance.CollectionName = CollectionName
-	Instance.ctx = context.Background()
 	var err error
-	switch getClientType(emulatorEnable, gcloudCredentialsPath) {
-	case EMULATOR:
-		os.Setenv("DATASTORE_EMULATOR_HOST", datastoreEmulatorAddr)
-		if Instance.client, err = datastore.NewClient(Instance.ctx, projectID); err != nil {
-			log.Fatal(err)
-		}
+	config := newConnectorConfig(emulatorEnable, datastoreEmulatorAddr, gcloudCredentialsPath, projectID, opts)
+	if Instance.connection, err = newConnection(config); err != nil {
+		log.Fatal(err)
+	}
 
-		break
-	case SIMPLE:
-		client, err := datastore.NewClient(Instance.ctx, projectID)
+	return Instance
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+func (d *datastoreAtomicConnector) IncrementCounter(entityID string, incrementAmount int) (success bool, err error) {
+	defer wrapErr(&err, "increment", d.CollectionName, entityID)
+	defer d.track("increment", d.CollectionName, entityID)()
+	_, err = d.updateCounter(entityID, func(counter *BasicCounter) bool {
+		counter.Amount = counter.Amount + incrementAmount
+		return true
+	})
 
-		Instance.client = client
-		break
-	case KEYFILE:
+	if err == nil {
+		success = true
+	}
 
-		jsonKey, err := ioutil.ReadFile(path.Join(gcloudCredentialsPath, "keyfile.json"))
+	return
+}
 
-		if err != nil {
-			log.Fatal(err)
+func (d *datastoreAtomicConnector) DecrementCounter(entityID string, decrementAmount int) (success bool, err error) {
+	defer wrapErr(&err, "decrement", d.CollectionName, entityID)
+	defer d.track("decrement", d.CollectionName, entityID)()
+	_, err = d.updateCounter(entityID, func(counter *BasicCounter) bool {
+		counter.Amount = counter.Amount - decrementAmount
+		if counter.Amount < 0 {
+			counter.Amount = 0
 		}
+		return true
+	})
 
-		conf, err := google.JWTConfigFromJSON(
-			jsonKey,
-			datastore.ScopeDatastore,
-		)
+	if err == nil {
+		success = true
+	}
 
-		if err != nil {
-			log.Fatal(err)
+	return
+}
+
+// InitCounter creates the counter with the initial amount in a transaction, an existing counter
+// is left untouched. created reports whether the counter was created.
+func (d *datastoreAtomicConnector) InitCounter(entityID string, initial int) (created bool, err error) {
+	defer wrapErr(&err, "init", d.CollectionName, entityID)
+	defer d.track("init", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+
+	err = d.counterTransaction(func(t *datastore.Transaction) (err error) {
+		exist, err := existInTransaction(t, inboundKey)
+		if created = err == nil && !exist; !created {
+			return
 		}
+		_, err = t.Put(inboundKey, &BasicCounter{Amount: initial})
+		return
+	}, entityID)
 
-		client, err := datastore.NewClient(
-			Instance.ctx,
-			projectID,
-			option.WithTokenSource(conf.TokenSource(Instance.ctx)),
-		)
+	if err != nil {
+		created = false
+	} else if created {
+		d.wrote(inboundKey)
+	}
 
+	return
+}
+
+// IncrementCounterMulti applies every increment of the map to its counter in one transaction,
+// either all of them change or none. Ids that WithKeyFunc maps to the same counter add up their
+// increments. A transaction is limited to 25 entity groups and every counter is its own group,
+// so more than 25 counters fail with ErrTooManyEntityGroups.
+func (d *datastoreAtomicConnector) IncrementCounterMulti(increments map[string]int) (err error) {
+	defer wrapErr(&err, "increment", d.CollectionName, "")
+	defer d.track("increment", d.CollectionName, "")()
+	keys := make([]*datastore.Key, 0, len(increments))
+	amounts := make([]int, 0, len(increments))
+	entityIDs := make([]string, 0, len(increments))
+	index := make(map[string]int, len(increments))
+	for entityID, incrementAmount := range increments {
+		key, err := d.validKey(d.CollectionName, entityID)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		// a key must not be written twice in one commit, its increments are summed instead
+		if i, seen := index[key.Encode()]; seen {
+			amounts[i] += incrementAmount
+			continue
 		}
+		index[key.Encode()] = len(keys)
+		entityIDs = append(entityIDs, entityID)
+		keys = append(keys, key)
+		amounts = append(amounts, incrementAmount)
+	}
+	if len(keys) > maxEntityGroups {
+		return fmt.Errorf("%w: %d counters, a transaction can change %d of them, split the increments in smaller calls",
+			ErrTooManyEntityGroups, len(keys), maxEntityGroups)
+	}
+
+	err = d.counterTransaction(func(t *datastore.Transaction) (err error) {
+		counters := make([]BasicCounter, len(keys))
+		if err = ignoreMissing(t.GetMulti(keys, counters)); err != nil {
+			return
+		}
+		for i := range counters {
+			counters[i].Amount += amounts[i]
+		}
+		_, err = t.PutMulti(keys, counters)
+		return
+	}, entityIDs...)
 
-		Instance.client = client
-		break
-	default:
-		log.Fatal("Unknown Datastore client")
-		break
+	if err == nil {
+		d.wrote(keys...)
 	}
 
-	return Instance
+	return
 }
 
-func (d *datastoreAtomicConnector) IncrementCounter(entityID string, incrementAmount int) (success bool) {
+// IncrementCounterApprox increments the counter with a plain read and write, without a
+// transaction. It is much cheaper than IncrementCounter but concurrent increments of the
+// same counter overwrite each other, so it is only suitable for approximate counters.
+func (d *datastoreAtomicConnector) IncrementCounterApprox(entityID string, incrementAmount int) (err error) {
+	defer wrapErr(&err, "increment", d.CollectionName, entityID)
+	defer d.track("increment", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	var counter BasicCounter
+	if err = d.client().Get(d.ctx, inboundKey, &counter); err != nil && err != datastore.ErrNoSuchEntity {
+		return
+	}
+
+	counter.Amount = counter.Amount + incrementAmount
+	if _, err = d.client().Put(d.ctx, inboundKey, &counter); err == nil {
+		d.wrote(inboundKey)
+	}
+	return
+}
 
-	t, err := d.client.NewTransaction(d.ctx)
+// IncrementCounterIfBelow increments the counter only when the result does not exceed limit.
+// It returns whether the increment was applied and the resulting counter amount.
+func (d *datastoreAtomicConnector) IncrementCounterIfBelow(entityID string, incrementAmount, limit int) (applied bool, amount int, err error) {
+	defer wrapErr(&err, "increment", d.CollectionName, entityID)
+	defer d.track("increment", d.CollectionName, entityID)()
+	counter, err := d.updateCounter(entityID, func(counter *BasicCounter) bool {
+		if applied = counter.Amount+incrementAmount <= limit; applied {
+			counter.Amount = counter.Amount + incrementAmount
+		}
+		return applied
+	})
 
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	var counter BasicCounter
-	err = t.Get(inboundKey, &counter)
-	if err == nil || err == datastore.ErrNoSuchEntity {
-		counter.Amount = counter.Amount + incrementAmount
-		_, err = t.Put(inboundKey, &counter)
-		_, err = t.Commit()
+	if err != nil {
+		return false, 0, err
 	}
 
-	if err == nil {
-		success = true
+	return applied, counter.Amount, nil
+}
+
+// TransferCounter moves amount from the fromID counter to the toID one in a single
+// transaction. Nothing changes and transferred is false when fromID holds less than amount.
+func (d *datastoreAtomicConnector) TransferCounter(fromID, toID string, amount int) (transferred bool, err error) {
+	defer wrapErr(&err, "transfer", d.CollectionName, fromID)
+	defer d.track("transfer", d.CollectionName, fromID)()
+	if amount < 0 {
+		return false, fmt.Errorf("connector: negative transfer amount %d", amount)
+	}
+	fromKey, err := d.validKey(d.CollectionName, fromID)
+	if err != nil {
+		return
+	}
+	toKey, err := d.validKey(d.CollectionName, toID)
+	if err != nil {
+		return
+	}
+	// WithKeyFunc may map both ids to the same key, it must not be written twice
+	sameCounter := fromKey.Equal(toKey)
+
+	transferIDs := []string{fromID, toID}
+	if sameCounter {
+		transferIDs = transferIDs[:1]
+	}
+	err = d.counterTransaction(func(t *datastore.Transaction) (err error) {
+		counters := make([]BasicCounter, 2)
+		if err = ignoreMissing(t.GetMulti([]*datastore.Key{fromKey, toKey}, counters)); err != nil {
+			return
+		}
+
+		if transferred = counters[0].Amount >= amount; !transferred || sameCounter {
+			return
+		}
+		counters[0].Amount -= amount
+		counters[1].Amount += amount
+		_, err = t.PutMulti([]*datastore.Key{fromKey, toKey}, counters)
+		return
+	}, transferIDs...)
+
+	if err != nil {
+		transferred = false
+	} else if transferred && !sameCounter {
+		d.wrote(fromKey, toKey)
 	}
 
 	return
 }
 
-func (d *datastoreAtomicConnector) DecrementCounter(entityID string, decrementAmount int) (success bool) {
-	t, err := d.client.NewTransaction(d.ctx)
+// updateCounter applies change to the stored counter in a transaction that is retried on
+// contention, nothing is written when change returns false
+func (d *datastoreAtomicConnector) updateCounter(entityID string, change func(counter *BasicCounter) bool) (result BasicCounter, err error) {
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
 
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
-	var counter BasicCounter
-	err = t.Get(inboundKey, &counter)
-	if err == nil || err == datastore.ErrNoSuchEntity {
-		counter.Amount = counter.Amount - decrementAmount
-		if counter.Amount < 0 {
-			counter.Amount = 0
+	written := false
+	err = d.counterTransaction(func(t *datastore.Transaction) (err error) {
+		result = BasicCounter{}
+		if err = t.Get(inboundKey, &result); err == datastore.ErrNoSuchEntity {
+			err = nil
+		} else if err != nil {
+			return
 		}
-		_, err = t.Put(inboundKey, &counter)
-		_, err = t.Commit()
-	}
 
-	if err == nil {
-		success = true
+		if written = change(&result); !written {
+			return
+		}
+		_, err = t.Put(inboundKey, &result)
+		return
+	}, entityID)
+
+	if err == nil && written {
+		d.wrote(inboundKey)
 	}
 
 	return
 }
 
-func (d *datastoreAtomicConnector) Count(entityID string) (amount int) {
-	t, err := d.client.NewTransaction(d.ctx)
+// counterTransaction runs f in a transaction and reports the attempts it needed to the
+// WithCounterAttemptsHook hook, once for every counter in entityIDs
+func (d *datastoreAtomicConnector) counterTransaction(f func(t *datastore.Transaction) error, entityIDs ...string) (err error) {
+	attempts := 0
+	_, err = d.runInTransaction(func(t *datastore.Transaction) error {
+		attempts++
+		return f(t)
+	})
 
-	inboundKey := datastore.NameKey(d.CollectionName, entityID, nil)
+	if d.config.counterAttempts != nil {
+		for _, entityID := range entityIDs {
+			d.config.counterAttempts(entityID, attempts)
+		}
+	}
+	return
+}
+
+// Count returns the counter amount, a missing counter counts 0 while read failures are returned
+func (d *datastoreAtomicConnector) Count(entityID string) (amount int, err error) {
+	defer wrapErr(&err, "count", d.CollectionName, entityID)
+	defer d.track("count", d.CollectionName, entityID)()
+	inboundKey := d.nameKey(d.CollectionName, entityID)
 	var counter BasicCounter
-	err = t.Get(inboundKey, &counter)
-	_, err = t.Commit()
+	if err = d.client().Get(d.ctx, inboundKey, &counter); err == datastore.ErrNoSuchEntity {
+		return 0, nil
+	}
 	if err != nil {
-		amount = 0
+		return
 	}
 
-	if err == nil {
-		amount = counter.Amount
-	}
+	amount = counter.Amount
+	return
+}
 
+// CountMultiOrZero returns the amount of every counter of entityIDs, missing counters count 0
+func (d *datastoreAtomicConnector) CountMultiOrZero(entityIDs []string) (amounts map[string]int, err error) {
+	defer wrapErr(&err, "count", d.CollectionName, "")
+	defer d.track("count", d.CollectionName, "")()
+	amounts = make(map[string]int, len(entityIDs))
+	err = d.forEachChunk(len(entityIDs), maxBatchSize, func(start, end int) (err error) {
+		keys := make([]*datastore.Key, end-start)
+		for i, entityID := range entityIDs[start:end] {
+			keys[i] = d.nameKey(d.CollectionName, entityID)
+		}
+
+		counters := make([]BasicCounter, len(keys))
+		if err = ignoreMissing(d.client().GetMulti(d.ctx, keys, counters)); err != nil {
+			return
+		}
+
+		for i, entityID := range entityIDs[start:end] {
+			amounts[entityID] = counters[i].Amount
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
 	return
 }
+
+// ignoreMissing drops the error of a GetMulti that only failed on missing entities, which are
+// left as zero values
+func ignoreMissing(err error) error {
+	multiErr, ok := err.(datastore.MultiError)
+	if !ok {
+		return err
+	}
+	for _, entryErr := range multiErr {
+		if entryErr != nil && entryErr != datastore.ErrNoSuchEntity {
+			return multiErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package connector
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// StreamDelete deletes the entities matching query while reading its keys, in batches of 500,
+// so the keys are never all held in memory. deleted counts the entities removed before an error.
+func (d *datastoreConnector) StreamDelete(query *datastore.Query) (deleted int, err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, "")
+	defer d.track("delete", d.CollectionName, "")()
+	deleted, _, err = d.deleteByQuery(query, time.Time{})
+	return
+}
+
+// DeleteByQueryBounded deletes the entities matching query like StreamDelete until they are
+// all gone or maxDuration elapses, complete reports whether nothing is left to delete.
+// The batch in flight when the time is up is still deleted.
+func (d *datastoreConnector) DeleteByQueryBounded(query *datastore.Query, maxDuration time.Duration) (deleted int, complete bool, err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, "")
+	defer d.track("delete", d.CollectionName, "")()
+	deleted, complete, err = d.deleteByQuery(query, time.Now().Add(maxDuration))
+	return
+}
+
+// deleteByQuery deletes the query matches in batches, it stops after the batch that reaches
+// deadline unless deadline is zero
+func (d *datastoreConnector) deleteByQuery(query *datastore.Query, deadline time.Time) (deleted int, complete bool, err error) {
+	var keys []*datastore.Key
+	flush := func() (err error) {
+		if len(keys) == 0 {
+			return
+		}
+		release := d.acquire()
+		if err = d.client().DeleteMulti(d.ctx, keys); err == nil {
+			deleted += len(keys)
+		}
+		release()
+		keys = nil
+		return
+	}
+
+	it := d.client().Run(d.ctx, d.prepareQuery(query.KeysOnly()))
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return deleted, false, err
+		}
+
+		if keys = append(keys, key); len(keys) == maxBatchSize {
+			if err = flush(); err != nil {
+				return deleted, false, err
+			}
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				return deleted, false, nil
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return deleted, false, err
+	}
+	return deleted, true, nil
+}
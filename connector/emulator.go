@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// emulatorPollInterval is the pause between two WaitForEmulator checks
+const emulatorPollInterval = 200 * time.Millisecond
+
+// WaitForEmulator polls the emulator address until it answers, ctx is done or timeout elapses.
+// It returns an error right away when the connector does not use the emulator.
+func (c *connection) WaitForEmulator(ctx context.Context, timeout time.Duration) (err error) {
+	defer wrapErr(&err, "wait for emulator", c.config.datastoreEmulatorAddr, "")
+	if !c.IsEmulator() {
+		return fmt.Errorf("connector: not an emulator connection (%v)", c.clientType)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	scheme, client := "http", &http.Client{Timeout: time.Second}
+	if c.config.emulatorTLS {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: c.config.emulatorTLSConfig}
+	}
+	url := scheme + "://" + c.config.datastoreEmulatorAddr + "/"
+
+	for {
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if reqErr != nil {
+			return reqErr
+		}
+		resp, getErr := client.Do(req)
+		if getErr == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			getErr = fmt.Errorf("status %s", resp.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("emulator not ready after %v: %v", timeout, getErr)
+		case <-time.After(emulatorPollInterval):
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package connector
+
+import (
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// connectorTag is the struct tag read by the connector, e.g. `datastore:"-" connector:"id"`
+const connectorTag = "connector"
+
+// defaultKeySeparator joins the parts of composed ids without WithKeyScheme
+const defaultKeySeparator = ":"
+
+// ComposeID joins the WithKeyScheme prefix and parts with the separator, e.g.
+// tenant:user:resource. A part that contains the separator is rejected with ErrInvalidEntityID,
+// ParseID could not split it back.
+func (c *connection) ComposeID(parts ...string) (entityID string, err error) {
+	sep := c.keySeparator()
+	for _, part := range parts {
+		if strings.Contains(part, sep) {
+			return "", fmt.Errorf("%w: part %q contains the separator %q", ErrInvalidEntityID, part, sep)
+		}
+	}
+	if c.config.keyPrefix != "" {
+		parts = append([]string{c.config.keyPrefix}, parts...)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// ParseID splits an id built by ComposeID back into its parts, nil when id does not start with
+// the WithKeyScheme prefix followed by the separator
+func (c *connection) ParseID(entityID string) []string {
+	sep := c.keySeparator()
+	if c.config.keyPrefix == "" {
+		return strings.Split(entityID, sep)
+	}
+	if !strings.HasPrefix(entityID, c.config.keyPrefix+sep) {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(entityID, c.config.keyPrefix+sep), sep)
+}
+
+func (c *connection) keySeparator() string {
+	if c.config.keySeparator == "" {
+		return defaultKeySeparator
+	}
+	return c.config.keySeparator
+}
+
+// SaveEntity saves entity, a struct pointer, under the id held by its string field tagged
+// `connector:"id"`. Tag the field `datastore:"-"` as well to keep it out of the properties.
+func (d *datastoreConnector) SaveEntity(entity interface{}) (key *datastore.Key, err error) {
+	entityID, err := taggedID(entity)
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	defer d.track("save", d.CollectionName, entityID)()
+	key, err = d.saveID(entityID, entity)
+	return
+}
+
+// SaveGenerated saves entity under a new id built by the WithIDGenerator generator, a random
+// UUID by default, and returns that id
+func (d *datastoreConnector) SaveGenerated(entity interface{}) (entityID string, key *datastore.Key, err error) {
+	if d.config.idGenerator != nil {
+		entityID = d.config.idGenerator()
+	} else {
+		entityID, err = newUUID()
+	}
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+	defer d.track("save", d.CollectionName, entityID)()
+	key, err = d.saveID(entityID, entity)
+	return
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("connector: generating id: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// taggedID returns the value of the string field of entity tagged `connector:"id"`
+func taggedID(entity interface{}) (string, error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return "", fmt.Errorf("connector: SaveEntity needs a struct pointer, got %T", entity)
+	}
+
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !hasTagOption(field.Tag.Get(connectorTag), "id") {
+			continue
+		}
+		if field.Type.Kind() != reflect.String {
+			return "", fmt.Errorf("connector: id field %s of %T is not a string", field.Name, entity)
+		}
+		return v.Field(i).String(), nil
+	}
+	return "", fmt.Errorf("connector: %T has no field tagged %s:\"id\"", entity, connectorTag)
+}
+
+func hasTagOption(tag, option string) bool {
+	for _, opt := range strings.Split(tag, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package connector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComposeID(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		sep     string
+		parts   []string
+		want    string
+		invalid bool
+	}{
+		{name: "default separator", parts: []string{"tenant", "user"}, want: "tenant:user"},
+		{name: "prefix", prefix: "app", parts: []string{"tenant", "user"}, want: "app:tenant:user"},
+		{name: "custom separator", prefix: "app", sep: "/", parts: []string{"a", "b"}, want: "app/a/b"},
+		{name: "part with separator", parts: []string{"a:b", "c"}, invalid: true},
+		{name: "part with custom separator", sep: "/", parts: []string{"a/b"}, invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &connection{config: connectorConfig{keyPrefix: test.prefix, keySeparator: test.sep}}
+			got, err := c.ComposeID(test.parts...)
+			if test.invalid {
+				if !errors.Is(err, ErrInvalidEntityID) {
+					t.Errorf("ComposeID(%q): got %q and error %v, want ErrInvalidEntityID", test.parts, got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("ComposeID(%q): got %q and error %v, want %q", test.parts, got, err, test.want)
+			}
+			if parsed := c.ParseID(got); !reflect.DeepEqual(parsed, test.parts) {
+				t.Errorf("ParseID(%q): got %q, want %q", got, parsed, test.parts)
+			}
+		})
+	}
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		entityID string
+		want     []string
+	}{
+		{entityID: "a:b", want: []string{"a", "b"}},
+		{prefix: "app", entityID: "app:a:b", want: []string{"a", "b"}},
+		{prefix: "app", entityID: "apple:b", want: nil},
+		{prefix: "app", entityID: "app", want: nil},
+		{prefix: "app", entityID: "other:a", want: nil},
+	}
+	for _, test := range tests {
+		c := &connection{config: connectorConfig{keyPrefix: test.prefix}}
+		if got := c.ParseID(test.entityID); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("prefix %q, ParseID(%q): got %q, want %q", test.prefix, test.entityID, got, test.want)
+		}
+	}
+}
+
+func TestValidateEntityID(t *testing.T) {
+	tests := []struct {
+		entityID string
+		valid    bool
+	}{
+		{entityID: "user-1", valid: true},
+		{entityID: "_single", valid: true},
+		{entityID: strings.Repeat("a", maxEntityIDLength), valid: true},
+		{entityID: "", valid: false},
+		{entityID: "__reserved__", valid: false},
+		{entityID: strings.Repeat("a", maxEntityIDLength+1), valid: false},
+	}
+	for _, test := range tests {
+		err := validateEntityID(test.entityID)
+		if test.valid && err != nil {
+			t.Errorf("validateEntityID(%.20q): got %v, want it valid", test.entityID, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidEntityID) {
+			t.Errorf("validateEntityID(%.20q): got %v, want ErrInvalidEntityID", test.entityID, err)
+		}
+	}
+}
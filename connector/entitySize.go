@@ -0,0 +1,74 @@
+package connector
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// EstimateSize returns about how many bytes datastore counts for entity once the save
+// transforms are applied, following the storage size rules of the datastore documentation.
+// The size of the entity key is not included.
+func (d *datastoreConnector) EstimateSize(entity interface{}) (size int, err error) {
+	defer wrapErr(&err, "estimate size", d.CollectionName, "")
+	props, err := d.config.encode(entity)
+	if err != nil {
+		return
+	}
+	size = propertiesSize(props)
+	return
+}
+
+// entityOverhead is the fixed size datastore adds to every entity
+const entityOverhead = 32
+
+func propertiesSize(props []datastore.Property) (size int) {
+	size = entityOverhead
+	for _, prop := range props {
+		size += len(prop.Name) + 1 + valueSize(prop.Value)
+	}
+	return
+}
+
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil, bool:
+		return 1
+	case int64, float64, time.Time:
+		return 8
+	case string:
+		return len(v) + 1
+	case []byte:
+		return len(v) + 1
+	case datastore.GeoPoint:
+		return 16
+	case *datastore.Key:
+		return keySize(v)
+	case *datastore.Entity:
+		size := propertiesSize(v.Properties)
+		if v.Key != nil {
+			size += keySize(v.Key)
+		}
+		return size
+	case []interface{}:
+		size := 0
+		for _, elem := range v {
+			size += valueSize(elem)
+		}
+		return size
+	}
+	return 8
+}
+
+// keySize adds the kind and the name or 8 bytes for the id of every level of key
+func keySize(key *datastore.Key) (size int) {
+	for k := key; k != nil; k = k.Parent {
+		size += len(k.Kind) + 1
+		if k.Name != "" {
+			size += len(k.Name) + 1
+		} else {
+			size += 8
+		}
+	}
+	return size + len(key.Namespace) + 16
+}
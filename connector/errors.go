@@ -0,0 +1,131 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned by the connectors are wrapped with the operation and the entity key,
+// use errors.Is to match them.
+var (
+	// ErrNotFound is returned when an operation requires an entity that does not exist
+	ErrNotFound = errors.New("connector: entity not found")
+	// ErrAlreadyExists is returned by insert only writes when the entity is already stored
+	ErrAlreadyExists = errors.New("connector: entity already exists")
+	// ErrConflict is returned when a transaction keeps failing due to concurrent writes,
+	// callers may back off and try again
+	ErrConflict = errors.New("connector: transaction conflict")
+	// ErrNamespaceMismatch is returned when a key outside the connector namespace is passed in
+	ErrNamespaceMismatch = errors.New("connector: key namespace mismatch")
+	// ErrTooManyEntityGroups is returned when a transaction touches more than 25 entity groups
+	ErrTooManyEntityGroups = errors.New("connector: too many entity groups in transaction")
+	// ErrInvalidEntityID is returned for empty, reserved or too long entity ids
+	ErrInvalidEntityID = errors.New("connector: invalid entity id")
+	// ErrAuthExpired is returned when datastore rejects the connector credentials, callers may
+	// Reconnect to authenticate again
+	ErrAuthExpired = errors.New("connector: credentials rejected")
+	// ErrMultipleInequalities is returned by QueryBuilder when inequality filters are set on
+	// more than one property, which datastore does not allow
+	ErrMultipleInequalities = errors.New("connector: inequality filters on more than one property")
+	// ErrDuplicateKeys is matched by the DuplicateKeysError of bulk saves
+	ErrDuplicateKeys = errors.New("connector: duplicate keys")
+	// ErrEntityTooLarge is returned when an entity is over the size set with WithMaxEntitySize
+	ErrEntityTooLarge = errors.New("connector: entity too large")
+	// ErrProjectMismatch is returned with WithStrictProjectCheck when the keyfile belongs to
+	// another project than the connector one
+	ErrProjectMismatch = errors.New("connector: keyfile project mismatch")
+	// ErrExplodingIndex is returned by QueryBuilder.CheckExplodingIndex for queries that need an
+	// index on several list properties
+	ErrExplodingIndex = errors.New("connector: query needs an exploding index")
+	// ErrInvalidGranularity is returned for a Granularity other than HOURLY or DAILY
+	ErrInvalidGranularity = errors.New("connector: invalid granularity")
+	// ErrWriterClosed is returned when adding entities to a closed BatchWriter
+	ErrWriterClosed = errors.New("connector: batch writer is closed")
+
+	errUnknownClient = errors.New("Unknown Datastore client")
+)
+
+// wrapErr adds the operation and the entity key to *err, it is meant to be deferred
+func wrapErr(err *error, op, kind, entityID string) {
+	if *err == nil {
+		return
+	}
+	// nested operations wrap the same error again, it is converted only once
+	if isAuthFailure(*err) && !errors.Is(*err, ErrAuthExpired) {
+		*err = authError{*err}
+	}
+	var mismatch *datastore.ErrFieldMismatch
+	var schemaMismatch *ErrSchemaMismatch
+	if errors.As(*err, &mismatch) && !errors.As(*err, &schemaMismatch) {
+		*err = &ErrSchemaMismatch{StructType: mismatch.StructType, FieldName: mismatch.FieldName, Reason: mismatch.Reason, err: *err}
+	}
+	if entityID == "" {
+		*err = fmt.Errorf("%s %s: %w", op, kind, *err)
+		return
+	}
+	*err = fmt.Errorf("%s %s/%s: %w", op, kind, entityID, *err)
+}
+
+// DuplicateKeysError lists the entity ids of a bulk save that repeat an earlier key
+type DuplicateKeysError struct {
+	EntityIDs []string
+}
+
+func (e *DuplicateKeysError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrDuplicateKeys, strings.Join(e.EntityIDs, ", "))
+}
+
+func (e *DuplicateKeysError) Is(target error) bool { return target == ErrDuplicateKeys }
+
+// UnsavedBatchError is returned when a BatchWriter batch fails, it lists the ids of the batch
+// entities so callers can add them again
+type UnsavedBatchError struct {
+	EntityIDs []string
+	err       error
+}
+
+func (e *UnsavedBatchError) Error() string {
+	return fmt.Sprintf("%d entities not saved: %v", len(e.EntityIDs), e.err)
+}
+
+func (e *UnsavedBatchError) Unwrap() error { return e.err }
+
+// ErrSchemaMismatch is returned when a stored property does not fit the destination struct.
+// The other fields are still loaded, so callers may choose to ignore some mismatches.
+type ErrSchemaMismatch struct {
+	StructType reflect.Type
+	FieldName  string
+	Reason     string
+	err        error
+}
+
+func (e *ErrSchemaMismatch) Error() string { return e.err.Error() }
+
+func (e *ErrSchemaMismatch) Unwrap() error { return e.err }
+
+// authError keeps the datastore error while matching ErrAuthExpired
+type authError struct {
+	err error
+}
+
+func (e authError) Error() string { return e.err.Error() }
+
+func (e authError) Unwrap() error { return e.err }
+
+func (e authError) Is(target error) bool { return target == ErrAuthExpired }
+
+// isAuthFailure reports whether datastore refused the request because of the credentials.
+// PermissionDenied is included because it is what datastore returns once a token is revoked.
+func isAuthFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// ExplainMetrics is the query profile returned by Explain
+type ExplainMetrics struct {
+	// IndexesUsed lists the indexes the query was planned on, e.g.
+	// {"query_scope": "Collection", "properties": "(foo ASC, __name__ ASC)"}
+	IndexesUsed       []map[string]interface{}
+	ResultsReturned   int64
+	ReadOperations    int64
+	ExecutionDuration time.Duration
+	// DebugStats holds the backend counters such as index_entries_scanned, their names may
+	// change with datastore releases
+	DebugStats map[string]interface{}
+}
+
+// Explain runs query in explain analyze mode and returns how it was planned and executed,
+// the results are read and dropped
+func (d *datastoreConnector) Explain(query *datastore.Query) (metrics ExplainMetrics, err error) {
+	defer wrapErr(&err, "explain", d.CollectionName, "")
+	defer d.track("explain", d.CollectionName, "")()
+	it := d.client().RunWithOptions(d.ctx, d.prepareQuery(query), datastore.ExplainOptions{Analyze: true})
+	for {
+		var props datastore.PropertyList
+		if _, err = it.Next(&props); err == iterator.Done {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if it.ExplainMetrics == nil {
+		return
+	}
+	if plan := it.ExplainMetrics.PlanSummary; plan != nil {
+		for _, index := range plan.IndexesUsed {
+			if index != nil {
+				metrics.IndexesUsed = append(metrics.IndexesUsed, *index)
+			}
+		}
+	}
+	if stats := it.ExplainMetrics.ExecutionStats; stats != nil {
+		metrics.ResultsReturned = stats.ResultsReturned
+		metrics.ReadOperations = stats.ReadOperations
+		if stats.ExecutionDuration != nil {
+			metrics.ExecutionDuration = *stats.ExecutionDuration
+		}
+		if stats.DebugStats != nil {
+			metrics.DebugStats = *stats.DebugStats
+		}
+	}
+	return
+}
@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// hotKeyTracker counts the writes of every entity group over consecutive windows
+type hotKeyTracker struct {
+	mu       sync.Mutex
+	window   time.Duration
+	start    time.Time
+	current  map[string]int
+	previous map[string]int
+}
+
+func newHotKeyTracker(window time.Duration) *hotKeyTracker {
+	return &hotKeyTracker{window: window, start: time.Now(), current: make(map[string]int)}
+}
+
+// roll starts a new window once the current one is over, must be called with t.mu held
+func (t *hotKeyTracker) roll(now time.Time) {
+	elapsed := now.Sub(t.start)
+	if elapsed < t.window {
+		return
+	}
+	t.previous = t.current
+	if elapsed >= 2*t.window {
+		// nothing was written during the last complete window
+		t.previous = nil
+	}
+	t.current = make(map[string]int)
+	t.start = now
+}
+
+func (t *hotKeyTracker) record(keys []*datastore.Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.roll(time.Now())
+	for _, key := range keys {
+		t.current[entityGroup(key)]++
+	}
+}
+
+// hot returns the groups written more than threshold times per second in the last window
+func (t *hotKeyTracker) hot(threshold float64) (groups []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.roll(time.Now())
+	for group, writes := range t.previous {
+		if float64(writes)/t.window.Seconds() > threshold {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	return
+}
+
+// entityGroup names the root of key, e.g. Org/bq, writes under the same root contend
+func entityGroup(key *datastore.Key) string {
+	for key.Parent != nil {
+		key = key.Parent
+	}
+	return key.Kind + "/" + keyID(key)
+}
+
+// HotKeys returns the entity groups written more than threshold times per second during the
+// last window of WithHotKeyTracking, it is always empty when tracking is off
+func (c *connection) HotKeys(threshold float64) []string {
+	if c.hotKeys == nil {
+		return nil
+	}
+	return c.hotKeys.hot(threshold)
+}
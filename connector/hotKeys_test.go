@@ -0,0 +1,65 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestEntityGroup(t *testing.T) {
+	org := datastore.NameKey("Org", "bq", nil)
+	tests := []struct {
+		key  *datastore.Key
+		want string
+	}{
+		{key: org, want: "Org/bq"},
+		{key: datastore.NameKey("User", "a", datastore.NameKey("Team", "x", org)), want: "Org/bq"},
+		{key: datastore.IDKey("Item", 42, nil), want: "Item/42"},
+	}
+	for _, test := range tests {
+		if got := entityGroup(test.key); got != test.want {
+			t.Errorf("entityGroup(%v) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	org := datastore.NameKey("Org", "bq", nil)
+	tracker := newHotKeyTracker(time.Second)
+	for i := 0; i < 5; i++ {
+		tracker.record([]*datastore.Key{datastore.NameKey("User", "a", org), datastore.NameKey("Item", "cold", nil)})
+	}
+	tracker.record([]*datastore.Key{org})
+
+	if hot := tracker.hot(1); len(hot) != 0 {
+		t.Errorf("got %v during the first window, want no hot groups yet", hot)
+	}
+
+	// end the window the writes were recorded in
+	tracker.mu.Lock()
+	tracker.start = tracker.start.Add(-tracker.window)
+	tracker.mu.Unlock()
+
+	if hot := tracker.hot(5); !reflect.DeepEqual(hot, []string{"Org/bq"}) {
+		t.Errorf("got %v, want [Org/bq]", hot)
+	}
+	if hot := tracker.hot(1); !reflect.DeepEqual(hot, []string{"Item/cold", "Org/bq"}) {
+		t.Errorf("got %v, want [Item/cold Org/bq]", hot)
+	}
+
+	// a whole window without writes forgets the previous one
+	tracker.mu.Lock()
+	tracker.start = tracker.start.Add(-2 * tracker.window)
+	tracker.mu.Unlock()
+	if hot := tracker.hot(0); len(hot) != 0 {
+		t.Errorf("got %v after an idle window, want no hot groups", hot)
+	}
+}
+
+func TestHotKeysOff(t *testing.T) {
+	if hot := (&connection{}).HotKeys(0); hot != nil {
+		t.Errorf("got %v without tracking, want nil", hot)
+	}
+}
@@ -0,0 +1,92 @@
+package connector
+
+import "cloud.google.com/go/datastore"
+
+// Record is a single entity written by ImportRecords
+type Record struct {
+	ID     string
+	Entity interface{}
+}
+
+// ImportResult reports the outcome of importing one Record
+type ImportResult struct {
+	ID  string
+	Key *datastore.Key
+	Err error
+}
+
+// ImportRecords saves records in batches and reports the outcome of each one instead of
+// failing the whole import. Transient failures are retried, err is only set when the
+// import is interrupted.
+func (d *datastoreConnector) ImportRecords(records []Record) (results []ImportResult, err error) {
+	defer d.track("import", d.CollectionName, "")()
+	results = make([]ImportResult, len(records))
+	err = d.forEachChunk(len(records), maxBatchSize, func(start, end int) error {
+		return d.importBatch(records[start:end], results[start:end])
+	})
+	return
+}
+
+func (d *datastoreConnector) importBatch(records []Record, results []ImportResult) (err error) {
+	keys := make([]*datastore.Key, len(records))
+	var pending []int
+	for i, record := range records {
+		results[i].ID = record.ID
+		if keys[i], results[i].Err = d.validKey(d.CollectionName, record.ID); results[i].Err != nil {
+			wrapErr(&results[i].Err, "import", d.CollectionName, record.ID)
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for attempt := 1; len(pending) > 0; {
+		batch := make([]*datastore.Key, len(pending))
+		entities := make([]interface{}, len(pending))
+		for j, i := range pending {
+			batch[j] = keys[i]
+			entities[j] = d.adapt(records[i].Entity)
+		}
+
+		_, putErr := d.client().PutMulti(d.ctx, batch, entities)
+		if multiErr, ok := putErr.(datastore.MultiError); ok {
+			// PutMulti only returns a MultiError when some entities cannot be encoded, nothing was
+			// sent and the entries left nil still have to be written without the failing ones
+			var encoded []int
+			for j, i := range pending {
+				if multiErr[j] == nil {
+					encoded = append(encoded, i)
+					continue
+				}
+				results[i].Err = multiErr[j]
+				wrapErr(&results[i].Err, "import", d.CollectionName, records[i].ID)
+			}
+			pending = encoded
+			continue
+		}
+
+		if putErr == nil {
+			for j, i := range pending {
+				results[i].Key = batch[j]
+			}
+			d.wrote(batch...)
+			return
+		}
+
+		if !d.retryable(putErr) || attempt == maxRetryAttempts {
+			for _, i := range pending {
+				results[i].Err = putErr
+				wrapErr(&results[i].Err, "import", d.CollectionName, records[i].ID)
+			}
+			return
+		}
+		if err = d.backoff(attempt); err != nil {
+			for _, i := range pending {
+				results[i].Err = err
+			}
+			return
+		}
+		attempt++
+	}
+
+	return
+}
@@ -0,0 +1,64 @@
+package connector_test
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/bq/datastore/connector"
+	"github.com/bq/datastore/connector/testutil"
+)
+
+type importedRow struct {
+	Name string
+}
+
+// unencodable cannot be saved, datastore does not support map fields
+type unencodable struct {
+	Values map[string]int
+}
+
+func TestImportRecordsMixedBatch(t *testing.T) {
+	conn, _, cleanup := testutil.StartEmulator(t, "ImportRow")
+	defer cleanup()
+
+	records := []connector.Record{
+		{ID: "good-1", Entity: &importedRow{Name: "one"}},
+		{ID: "", Entity: &importedRow{Name: "empty id"}},
+		{ID: "broken", Entity: &unencodable{Values: map[string]int{"a": 1}}},
+		{ID: "__reserved__", Entity: &importedRow{Name: "reserved id"}},
+		{ID: "good-2", Entity: &importedRow{Name: "two"}},
+	}
+	results, err := conn.ImportRecords(records)
+	if err != nil {
+		t.Fatalf("ImportRecords: %v", err)
+	}
+	if len(results) != len(records) {
+		t.Fatalf("got %d results for %d records", len(results), len(records))
+	}
+
+	stored := map[string]bool{"good-1": true, "good-2": true}
+	for i, result := range results {
+		if result.ID != records[i].ID {
+			t.Errorf("result %d is for %q, want %q", i, result.ID, records[i].ID)
+		}
+		if stored[result.ID] {
+			if result.Err != nil || result.Key == nil {
+				t.Errorf("%q: got key %v and error %v, want it saved", result.ID, result.Key, result.Err)
+			}
+		} else if result.Err == nil || result.Key != nil {
+			t.Errorf("%q: got key %v and error %v, want it rejected", result.ID, result.Key, result.Err)
+		}
+	}
+
+	for _, entityID := range []string{"good-1", "good-2"} {
+		var row importedRow
+		if err = conn.Retrieve(entityID, &row); err != nil {
+			t.Errorf("Retrieve(%q): %v", entityID, err)
+		}
+	}
+	var row importedRow
+	if err = conn.Retrieve("broken", &row); !errors.Is(err, datastore.ErrNoSuchEntity) {
+		t.Errorf("Retrieve(broken): got %v, want it missing", err)
+	}
+}
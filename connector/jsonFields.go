@@ -0,0 +1,71 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+)
+
+// jsonFieldIndexes returns the struct value entity points to and the index of its fields tagged
+// `connector:"json"`, ok is false for anything but a struct pointer
+func jsonFieldIndexes(entity interface{}) (v reflect.Value, indexes []int, ok bool) {
+	v = reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return v, nil, false
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if hasTagOption(v.Type().Field(i).Tag.Get(connectorTag), "json") {
+			indexes = append(indexes, i)
+		}
+	}
+	return v, indexes, true
+}
+
+// encodeJSONFields appends the JSON encoding of the json tagged fields of entity to props as
+// unindexed properties named after the fields
+func encodeJSONFields(entity interface{}, props datastore.PropertyList) (datastore.PropertyList, error) {
+	v, indexes, ok := jsonFieldIndexes(entity)
+	if !ok {
+		return props, nil
+	}
+	for _, i := range indexes {
+		name := v.Type().Field(i).Name
+		data, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", name, err)
+		}
+		props = append(props, datastore.Property{Name: name, Value: data, NoIndex: true})
+	}
+	return props, nil
+}
+
+// decodeJSONFields decodes the properties of the json tagged fields of entity into them and
+// returns the other properties
+func decodeJSONFields(entity interface{}, props datastore.PropertyList) (datastore.PropertyList, error) {
+	v, indexes, ok := jsonFieldIndexes(entity)
+	if !ok || len(indexes) == 0 {
+		return props, nil
+	}
+
+	fields := make(map[string]int, len(indexes))
+	for _, i := range indexes {
+		fields[v.Type().Field(i).Name] = i
+	}
+
+	rest := props[:0:0]
+	for _, prop := range props {
+		i, isJSON := fields[prop.Name]
+		data, isBytes := prop.Value.([]byte)
+		if !isJSON || !isBytes {
+			rest = append(rest, prop)
+			continue
+		}
+		if err := json.Unmarshal(data, v.Field(i).Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", prop.Name, err)
+		}
+	}
+	return rest, nil
+}
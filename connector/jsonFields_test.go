@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+type settings struct {
+	Theme  string
+	Limits map[string]int
+}
+
+type account struct {
+	Name     string
+	Settings settings `datastore:"-" connector:"json"`
+	Tags     []string `datastore:"-" connector:"json"`
+}
+
+func TestJSONFieldsRoundTrip(t *testing.T) {
+	saved := &account{
+		Name:     "bq",
+		Settings: settings{Theme: "dark", Limits: map[string]int{"daily": 10}},
+		Tags:     []string{"a", "b"},
+	}
+	props, err := encodeJSONFields(saved, datastore.PropertyList{{Name: "Name", Value: "bq"}})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(props) != 3 {
+		t.Fatalf("got %d properties, want Name and the two json fields", len(props))
+	}
+	for _, prop := range props[1:] {
+		if _, ok := prop.Value.([]byte); !ok || !prop.NoIndex {
+			t.Errorf("%s: got %T indexed %v, want unindexed bytes", prop.Name, prop.Value, !prop.NoIndex)
+		}
+	}
+
+	loaded := &account{}
+	rest, err := decodeJSONFields(loaded, props)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Settings, saved.Settings) || !reflect.DeepEqual(loaded.Tags, saved.Tags) {
+		t.Errorf("got %+v, want the json fields of %+v", loaded, saved)
+	}
+	if len(rest) != 1 || rest[0].Name != "Name" {
+		t.Errorf("got the remaining properties %v, want only Name", rest)
+	}
+	if len(props) != 3 {
+		t.Errorf("decode changed the properties it was given: %v", props)
+	}
+}
+
+func TestJSONFieldsSkipped(t *testing.T) {
+	props := datastore.PropertyList{{Name: "Name", Value: "bq"}}
+	for _, entity := range []interface{}{account{}, (*account)(nil), &datastore.PropertyList{}, &struct{ Name string }{}} {
+		encoded, err := encodeJSONFields(entity, props)
+		if err != nil || !reflect.DeepEqual(encoded, props) {
+			t.Errorf("encode %T: got %v and error %v, want the properties unchanged", entity, encoded, err)
+		}
+		decoded, err := decodeJSONFields(entity, props)
+		if err != nil || !reflect.DeepEqual(decoded, props) {
+			t.Errorf("decode %T: got %v and error %v, want the properties unchanged", entity, decoded, err)
+		}
+	}
+}
+
+func TestDecodeJSONFieldsInvalid(t *testing.T) {
+	props := datastore.PropertyList{{Name: "Tags", Value: []byte("not json")}}
+	if _, err := decodeJSONFields(&account{}, props); err == nil {
+		t.Error("got no error for an invalid json property")
+	}
+}
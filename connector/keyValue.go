@@ -0,0 +1,68 @@
+package connector
+
+import (
+	"log"
+
+	"cloud.google.com/go/datastore"
+)
+
+// KeyValueOpt is a plain key value store on top of a datastore kind
+type KeyValueOpt interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+}
+
+type keyValue struct {
+	*datastoreConnector
+}
+
+// NewKV is a factory method that create a key value store saving every value as an
+// unindexed blob entity of the CollectionName kind
+func NewKV(emulatorEnable bool, datastoreEmulatorAddr string, gcloudCredentialsPath, projectID, CollectionName string, opts ...Option) KeyValueOpt {
+	var Instance = new(keyValue)
+	Instance.datastoreConnector = &datastoreConnector{CollectionName: CollectionName}
+	var err error
+	config := newConnectorConfig(emulatorEnable, datastoreEmulatorAddr, gcloudCredentialsPath, projectID, opts)
+	if Instance.connection, err = newConnection(config); err != nil {
+		log.Fatal(err)
+	}
+
+	return Instance
+}
+
+// Get returns the value of key, ErrNotFound when it is not set
+func (kv *keyValue) Get(key string) (value []byte, err error) {
+	defer wrapErr(&err, "get", kv.CollectionName, key)
+	defer kv.track("get", kv.CollectionName, key)()
+	inboundKey, err := kv.validKey(kv.CollectionName, key)
+	if err != nil {
+		return
+	}
+	var blob blobEntity
+	if err = kv.get(inboundKey, &blob); err == datastore.ErrNoSuchEntity {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return
+	}
+	value = blob.Data
+	return
+}
+
+// Set stores value under key, replacing the previous one
+func (kv *keyValue) Set(key string, value []byte) (err error) {
+	_, err = kv.SaveBlob(key, value)
+	return
+}
+
+// Delete removes key, deleting a key that is not set is not an error
+func (kv *keyValue) Delete(key string) (err error) {
+	defer wrapErr(&err, "delete", kv.CollectionName, key)
+	defer kv.track("delete", kv.CollectionName, key)()
+	inboundKey, err := kv.validKey(kv.CollectionName, key)
+	if err != nil {
+		return
+	}
+	err = kv.client().Delete(kv.ctx, inboundKey)
+	return
+}
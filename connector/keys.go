@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"cloud.google.com/go/datastore"
+)
+
+// maxInFilterValues is the maximum number of values datastore accepts in an in filter
+const maxInFilterValues = 30
+
+// RetrieveByKeys loads keys into dst, a slice of the same length, with a single lookup.
+// Missing entities are reported as datastore.ErrNoSuchEntity in a datastore.MultiError.
+func (d *datastoreConnector) RetrieveByKeys(keys []*datastore.Key, dst interface{}) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, "")
+	defer d.track("retrieve", d.CollectionName, "")()
+	if err = d.checkNamespace(keys); err != nil {
+		return
+	}
+	err = d.client().GetMulti(d.ctx, keys, d.adaptMulti(dst))
+	return
+}
+
+// Resolve loads the entities of targetKind named by refs into dst, a slice of the same length,
+// with a single lookup, e.g. the customers referenced by a page of orders. Missing entities are
+// reported as datastore.ErrNoSuchEntity in a datastore.MultiError, like RetrieveByKeys.
+func (d *datastoreConnector) Resolve(refs []string, targetKind string, dst interface{}) (err error) {
+	defer wrapErr(&err, "resolve", targetKind, "")
+	defer d.track("resolve", targetKind, "")()
+	keys := make([]*datastore.Key, len(refs))
+	for i, ref := range refs {
+		if keys[i], err = d.validKey(targetKind, ref); err != nil {
+			return
+		}
+	}
+	err = d.client().GetMulti(d.ctx, keys, d.adaptMulti(dst))
+	return
+}
+
+// RetrieveByKeysWhere runs query restricted to keys with a __key__ in filter and appends the
+// matches to dst, so key membership can be combined with other filters.
+// The keys are sent in groups of 30, order and limit apply to each group, not to the whole result.
+func (d *datastoreConnector) RetrieveByKeysWhere(keys []*datastore.Key, query *datastore.Query, dst interface{}) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	if err = d.checkNamespace(keys); err != nil {
+		return
+	}
+	err = d.forEachChunk(len(keys), maxInFilterValues, func(start, end int) (err error) {
+		values := make([]interface{}, 0, end-start)
+		for _, key := range keys[start:end] {
+			values = append(values, key)
+		}
+		_, err = d.getAll(d.ctx, d.prepareQuery(query.FilterField("__key__", "in", values)), dst)
+		return
+	})
+	return
+}
+
+// QueryKeysRaw runs query as a keys only query and returns the keys as datastore gives them,
+// ready for DeleteKeys or UpdateKeys
+func (d *datastoreConnector) QueryKeysRaw(query *datastore.Query) (keys []*datastore.Key, err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	keys, err = d.client().GetAll(d.ctx, d.prepareQuery(query.KeysOnly()), nil)
+	return
+}
+
+// DeleteKeys deletes keys in batches of 500, missing entities are ignored
+func (d *datastoreConnector) DeleteKeys(keys []*datastore.Key) (err error) {
+	defer wrapErr(&err, "delete", d.CollectionName, "")
+	defer d.track("delete", d.CollectionName, "")()
+	if err = d.checkNamespace(keys); err != nil {
+		return
+	}
+	err = d.forEachChunk(len(keys), maxBatchSize, func(start, end int) error {
+		return d.client().DeleteMulti(d.ctx, keys[start:end])
+	})
+	return
+}
+
+// UpdateKeys reads keys in batches of 500 and saves every entity after update changed it,
+// missing entities are skipped. Batches are not transactional, an entity written between
+// the read and the write of its batch is overwritten.
+func (d *datastoreConnector) UpdateKeys(keys []*datastore.Key, update func(key *datastore.Key, entity *datastore.PropertyList) error) (err error) {
+	defer wrapErr(&err, "update", d.CollectionName, "")
+	defer d.track("update", d.CollectionName, "")()
+	if err = d.checkNamespace(keys); err != nil {
+		return
+	}
+	err = d.forEachChunk(len(keys), maxBatchSize, func(start, end int) (err error) {
+		batch := keys[start:end]
+		entities := make([]datastore.PropertyList, len(batch))
+		dst := make([]interface{}, len(batch))
+		for i := range entities {
+			dst[i] = d.adapt(&entities[i])
+		}
+
+		found := make([]bool, len(batch))
+		err = d.client().GetMulti(d.ctx, batch, dst)
+		multiErr, isMulti := err.(datastore.MultiError)
+		if err != nil && !isMulti {
+			return
+		}
+		for i := range batch {
+			switch {
+			case !isMulti || multiErr[i] == nil:
+				found[i] = true
+			case multiErr[i] != datastore.ErrNoSuchEntity:
+				return multiErr
+			}
+		}
+
+		var putKeys []*datastore.Key
+		var src []interface{}
+		for i, key := range batch {
+			if !found[i] {
+				continue
+			}
+			if err = update(key, &entities[i]); err != nil {
+				return
+			}
+			putKeys = append(putKeys, key)
+			src = append(src, d.adapt(&entities[i]))
+		}
+		if len(putKeys) == 0 {
+			return
+		}
+		if _, err = d.client().PutMulti(d.ctx, putKeys, src); err == nil {
+			d.wrote(putKeys...)
+		}
+		return
+	})
+	return
+}
@@ -0,0 +1,78 @@
+package connector
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// negativeCache remembers recently missing keys, the least recently used is evicted first
+type negativeCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type negativeEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newNegativeCache(size int, ttl time.Duration) *negativeCache {
+	return &negativeCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func cacheKey(key *datastore.Key) string {
+	return key.Namespace + "|" + key.String()
+}
+
+// missing reports whether key was found missing less than ttl ago
+func (n *negativeCache) missing(key *datastore.Key) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	elem, ok := n.entries[cacheKey(key)]
+	if !ok {
+		return false
+	}
+	if time.Now().After(elem.Value.(*negativeEntry).expires) {
+		n.remove(elem)
+		return false
+	}
+	n.order.MoveToFront(elem)
+	return true
+}
+
+func (n *negativeCache) add(key *datastore.Key) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	cached := cacheKey(key)
+	if elem, ok := n.entries[cached]; ok {
+		elem.Value.(*negativeEntry).expires = time.Now().Add(n.ttl)
+		n.order.MoveToFront(elem)
+		return
+	}
+	n.entries[cached] = n.order.PushFront(&negativeEntry{key: cached, expires: time.Now().Add(n.ttl)})
+	if n.order.Len() > n.size {
+		n.remove(n.order.Back())
+	}
+}
+
+func (n *negativeCache) invalidate(keys []*datastore.Key) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := n.entries[cacheKey(key)]; ok {
+			n.remove(elem)
+		}
+	}
+}
+
+// remove must be called with n.mu held
+func (n *negativeCache) remove(elem *list.Element) {
+	n.order.Remove(elem)
+	delete(n.entries, elem.Value.(*negativeEntry).key)
+}
@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestNegativeCache(t *testing.T) {
+	a, b, c := datastore.NameKey("K", "a", nil), datastore.NameKey("K", "b", nil), datastore.NameKey("K", "c", nil)
+	cache := newNegativeCache(2, time.Hour)
+
+	if cache.missing(a) {
+		t.Error("empty cache: got a missing")
+	}
+	cache.add(a)
+	cache.add(b)
+	if !cache.missing(a) || !cache.missing(b) {
+		t.Error("got a or b not missing after adding them")
+	}
+
+	// a was looked up last, b is the least recently used
+	cache.missing(a)
+	cache.add(c)
+	if cache.missing(b) {
+		t.Error("got b missing, want it evicted")
+	}
+	if !cache.missing(a) || !cache.missing(c) {
+		t.Error("got a or c evicted, want b evicted")
+	}
+
+	cache.invalidate([]*datastore.Key{a})
+	if cache.missing(a) {
+		t.Error("got a missing after invalidating it")
+	}
+}
+
+func TestNegativeCacheNamespaces(t *testing.T) {
+	cache := newNegativeCache(10, time.Hour)
+	key := datastore.NameKey("K", "a", nil)
+	key.Namespace = "tenant"
+	cache.add(key)
+
+	other := datastore.NameKey("K", "a", nil)
+	if cache.missing(other) {
+		t.Error("got the key missing in another namespace")
+	}
+}
+
+func TestNegativeCacheTTL(t *testing.T) {
+	key := datastore.NameKey("K", "a", nil)
+	cache := newNegativeCache(10, -time.Second)
+	cache.add(key)
+	if cache.missing(key) {
+		t.Error("got an expired key missing")
+	}
+	if len(cache.entries) != 0 || cache.order.Len() != 0 {
+		t.Errorf("got %d entries, want the expired key removed", len(cache.entries))
+	}
+}
@@ -0,0 +1,228 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
+// Option configures optional connector behaviour, options are passed to the factory methods
+type Option func(config *connectorConfig)
+
+// WithEmulatorTLS connects to the emulator over TLS instead of plaintext.
+// A nil tlsConfig uses the default TLS configuration.
+func WithEmulatorTLS(tlsConfig *tls.Config) Option {
+	return func(config *connectorConfig) {
+		config.emulatorTLS = true
+		config.emulatorTLSConfig = tlsConfig
+	}
+}
+
+// WithMissingAsNil makes Retrieve of a missing entity zero dst and return no error
+func WithMissingAsNil() Option {
+	return func(config *connectorConfig) {
+		config.missingAsNil = true
+	}
+}
+
+// WithContext sets the parent context of every operation, cancelling it aborts in-flight calls
+func WithContext(ctx context.Context) Option {
+	return func(config *connectorConfig) {
+		config.ctx = ctx
+	}
+}
+
+// WithKeyFunc transforms every entity id, e.g. to normalise or prefix it, before its key is built
+func WithKeyFunc(keyFunc func(id string) string) Option {
+	return func(config *connectorConfig) {
+		config.keyFunc = keyFunc
+	}
+}
+
+// WithCounterAttemptsHook reports how many transaction attempts every counter transaction
+// needed, once for every counter it read, a growing number of attempts means the counter is a
+// write hotspot
+func WithCounterAttemptsHook(hook func(entityID string, attempts int)) Option {
+	return func(config *connectorConfig) {
+		config.counterAttempts = hook
+	}
+}
+
+// WithNamespace stores and looks up the connector entities in namespace, ids are then
+// unique per namespace
+func WithNamespace(namespace string) Option {
+	return func(config *connectorConfig) {
+		config.namespace = namespace
+	}
+}
+
+// WithInsertOnly makes Save fail with ErrAlreadyExists instead of overwriting an existing entity.
+// It covers the single entity saves built on Save, such as SaveEntity, SaveProperties,
+// SaveWithAncestors or SaveAndRetrieve. The bulk writes, SaveMulti, SaveAll, UpsertMulti,
+// BatchWriter and ImportRecords, still overwrite existing entities.
+func WithInsertOnly() Option {
+	return func(config *connectorConfig) {
+		config.insertOnly = true
+	}
+}
+
+// WithEndpoint connects to a specific datastore endpoint, e.g. a regional one. It has no
+// effect on emulator connections.
+func WithEndpoint(endpoint string) Option {
+	return func(config *connectorConfig) {
+		config.endpoint = endpoint
+	}
+}
+
+// WithUserAgent identifies the service in the datastore client user agent
+func WithUserAgent(userAgent string) Option {
+	return func(config *connectorConfig) {
+		config.userAgent = userAgent
+	}
+}
+
+// WithSlowOpThreshold calls hook for every operation that takes threshold or longer,
+// key is the kind and entity id the operation worked on
+func WithSlowOpThreshold(threshold time.Duration, hook func(op, key string, took time.Duration)) Option {
+	return func(config *connectorConfig) {
+		config.slowOpThreshold = threshold
+		config.slowOpHook = hook
+	}
+}
+
+// WithCompressedField gzips the []byte property name when entities are saved and unzips it
+// when they are loaded, the property is stored unindexed. Values saved before the option
+// was set are loaded as they are.
+func WithCompressedField(name string) Option {
+	return func(config *connectorConfig) {
+		config.saveTransforms = append(config.saveTransforms, compressProperty(name))
+		config.loadTransforms = append(config.loadTransforms, decompressProperty(name))
+	}
+}
+
+// WithNoIndexes saves every property unindexed, for kinds that are only read by key
+func WithNoIndexes() Option {
+	return func(config *connectorConfig) {
+		config.saveTransforms = append(config.saveTransforms, unindexProperties)
+	}
+}
+
+// WithRetryPolicy decides which batch errors ImportRecords retries, replacing the default
+// that retries the temporary failures such as Unavailable or DeadlineExceeded. The other
+// operations do not use it, their requests are only retried by the datastore client itself
+// on codes such as Unavailable, whatever this policy says.
+func WithRetryPolicy(retryable func(err error) bool) Option {
+	return func(config *connectorConfig) {
+		config.retryPolicy = retryable
+	}
+}
+
+// WithMaxEntitySize makes writes fail with ErrEntityTooLarge when the estimated size of an
+// entity is over maxBytes, datastore rejects entities over 1 MiB
+func WithMaxEntitySize(maxBytes int) Option {
+	return func(config *connectorConfig) {
+		config.maxEntitySize = maxBytes
+	}
+}
+
+// WithEventualConsistency runs the queries of the connector with eventual consistency, they
+// are faster but may miss recent writes. QueryWithAncestor stays strongly consistent. A query
+// the caller restricted with Ancestor cannot be told apart and is made eventually consistent
+// too, run it through QueryWithAncestor to keep it strongly consistent.
+func WithEventualConsistency() Option {
+	return func(config *connectorConfig) {
+		config.eventualConsistency = true
+	}
+}
+
+// WithHotKeyTracking counts the writes of every entity group over windows of the given size
+// so HotKeys can report the groups written too often
+func WithHotKeyTracking(window time.Duration) Option {
+	return func(config *connectorConfig) {
+		config.hotKeyWindow = window
+	}
+}
+
+// WithNegativeCache remembers up to size keys Retrieve found missing for ttl, reading them
+// again in that time returns the not found error without a datastore call. Writes through
+// the connector forget the keys they save, writes from other processes are not seen.
+func WithNegativeCache(size int, ttl time.Duration) Option {
+	return func(config *connectorConfig) {
+		config.negativeCacheSize = size
+		config.negativeCacheTTL = ttl
+	}
+}
+
+// WithStrictProjectCheck makes the factory fail when the keyfile belongs to another project
+// than projectID, by default the mismatch is only logged
+func WithStrictProjectCheck() Option {
+	return func(config *connectorConfig) {
+		config.strictProjectCheck = true
+	}
+}
+
+// WithTimeLocation loads the time values of the entities in loc. Datastore keeps times as UTC
+// instants with microsecond precision, the location they were saved with is not stored, so
+// without this option they are loaded in UTC.
+func WithTimeLocation(loc *time.Location) Option {
+	return func(config *connectorConfig) {
+		config.loadTransforms = append(config.loadTransforms, inLocation(loc))
+	}
+}
+
+// WithJSONFields stores the struct fields tagged `datastore:"-" connector:"json"` as an
+// unindexed JSON property named after the field, for types datastore cannot save such as maps
+func WithJSONFields() Option {
+	return func(config *connectorConfig) {
+		config.jsonFields = true
+	}
+}
+
+// WithKeyFileOrADC uses the keyfile.json of gcloudCredentialsPath when it exists and the
+// application default credentials otherwise, instead of failing on a missing keyfile
+func WithKeyFileOrADC(gcloudCredentialsPath string) Option {
+	return func(config *connectorConfig) {
+		config.gcloudCredentialsPath = gcloudCredentialsPath
+		config.keyfileOptional = true
+	}
+}
+
+// WithMaxConcurrency allows at most n batch requests of the bulk operations in flight at once
+// across all the goroutines using the connector, the others wait for a free slot
+func WithMaxConcurrency(n int) Option {
+	return func(config *connectorConfig) {
+		config.maxConcurrency = n
+	}
+}
+
+// WithLabels adds labels to every operation reported to the WithOperationHook hook
+func WithLabels(labels map[string]string) Option {
+	return func(config *connectorConfig) {
+		config.labels = mergeLabels(config.labels, labels)
+	}
+}
+
+// WithOperationHook calls hook once every connector operation is done, e.g. to export
+// metrics tagged with the operation labels
+func WithOperationHook(hook func(op Operation)) Option {
+	return func(config *connectorConfig) {
+		config.operationHook = hook
+	}
+}
+
+// WithIDGenerator sets the generator of the ids used by SaveGenerated, e.g. to build ULIDs
+// instead of the default random UUIDs
+func WithIDGenerator(generator func() string) Option {
+	return func(config *connectorConfig) {
+		config.idGenerator = generator
+	}
+}
+
+// WithKeyScheme sets the prefix and the separator ComposeID and ParseID use for ids made of
+// several parts, the separator defaults to ":"
+func WithKeyScheme(prefix string, sep string) Option {
+	return func(config *connectorConfig) {
+		config.keyPrefix = prefix
+		config.keySeparator = sep
+	}
+}
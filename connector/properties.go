@@ -0,0 +1,201 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// loadProperties decodes props into dst, a struct pointer or a PropertyLoadSaver
+func loadProperties(dst interface{}, props datastore.PropertyList) error {
+	if pls, ok := dst.(datastore.PropertyLoadSaver); ok {
+		return pls.Load(props)
+	}
+	return datastore.LoadStruct(dst, props)
+}
+
+// saveProperties encodes src, a struct pointer or a PropertyLoadSaver, as datastore would store it
+func saveProperties(src interface{}) (props datastore.PropertyList, err error) {
+	if pls, ok := src.(datastore.PropertyLoadSaver); ok {
+		return pls.Save()
+	}
+	return datastore.SaveStruct(src)
+}
+
+func (c *connection) propertiesDecoder(props datastore.PropertyList) func(dst interface{}) error {
+	return func(dst interface{}) error {
+		return loadProperties(c.adapt(dst), props)
+	}
+}
+
+// propertyTransform rewrites the properties of an entity on its way to or from datastore
+type propertyTransform func(props datastore.PropertyList) (datastore.PropertyList, error)
+
+func unindexProperties(props datastore.PropertyList) (datastore.PropertyList, error) {
+	for i := range props {
+		props[i].NoIndex = true
+	}
+	return props, nil
+}
+
+// inLocation returns a load transform moving every time value, nested ones included, to loc
+func inLocation(loc *time.Location) propertyTransform {
+	var convert func(value interface{}) interface{}
+	convert = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case time.Time:
+			return v.In(loc)
+		case []interface{}:
+			for i := range v {
+				v[i] = convert(v[i])
+			}
+		case *datastore.Entity:
+			for i := range v.Properties {
+				v.Properties[i].Value = convert(v.Properties[i].Value)
+			}
+		}
+		return value
+	}
+
+	return func(props datastore.PropertyList) (datastore.PropertyList, error) {
+		for i := range props {
+			props[i].Value = convert(props[i].Value)
+		}
+		return props, nil
+	}
+}
+
+// entityAdapter runs the connector transforms between entity and datastore
+type entityAdapter struct {
+	entity interface{}
+	config *connectorConfig
+}
+
+// adapt wraps entity so the transforms and checks set through Option are applied when it is
+// saved or loaded, it returns entity itself when there are none or it is already wrapped
+func (c *connection) adapt(entity interface{}) interface{} {
+	if _, wrapped := entity.(*entityAdapter); wrapped || !c.adapts() {
+		return entity
+	}
+	return &entityAdapter{entity: entity, config: &c.config}
+}
+
+// adapts reports whether entities need the adapter to be saved or loaded
+func (c *connection) adapts() bool {
+	return len(c.config.saveTransforms) > 0 || len(c.config.loadTransforms) > 0 || c.config.maxEntitySize > 0 || c.config.jsonFields
+}
+
+// adaptMulti returns dst, a GetMulti or PutMulti slice, as a []interface{} of its adapted
+// elements. Nil struct pointers are allocated as GetMulti would.
+func (c *connection) adaptMulti(dst interface{}) interface{} {
+	v := reflect.ValueOf(dst)
+	if !c.adapts() || v.Kind() != reflect.Slice {
+		return dst
+	}
+
+	elems := make([]interface{}, v.Len())
+	for i := range elems {
+		elem := v.Index(i)
+		switch elem.Kind() {
+		case reflect.Interface:
+			elems[i] = c.adapt(elem.Interface())
+		case reflect.Ptr:
+			if elem.IsNil() {
+				elem.Set(reflect.New(elem.Type().Elem()))
+			}
+			elems[i] = c.adapt(elem.Interface())
+		default:
+			elems[i] = c.adapt(elem.Addr().Interface())
+		}
+	}
+	return elems
+}
+
+// getAll is GetAll loading every result through adapt. Like GetAll it keeps loading after a
+// field mismatch and returns the first one once the query is done.
+func (c *connection) getAll(ctx context.Context, query *datastore.Query, dst interface{}) (keys []*datastore.Key, err error) {
+	if dst == nil || !c.adapts() {
+		return c.client().GetAll(ctx, query, dst)
+	}
+	slice := reflect.ValueOf(dst)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("connector: dst must be a pointer to a slice, got %T", dst)
+	}
+	slice = slice.Elem()
+
+	var mismatch error
+	it := c.client().Run(ctx, query)
+	for {
+		elem := newElem(slice.Type().Elem())
+		key, err := it.Next(c.adapt(elem.Interface()))
+		if err == iterator.Done {
+			return keys, mismatch
+		}
+		if _, isMismatch := err.(*datastore.ErrFieldMismatch); err != nil && !isMismatch {
+			return keys, err
+		} else if isMismatch && mismatch == nil {
+			mismatch = err
+		}
+		keys = append(keys, key)
+		appendElem(slice, elem)
+	}
+}
+
+func (a *entityAdapter) Load(props []datastore.Property) (err error) {
+	list := datastore.PropertyList(props)
+	for _, transform := range a.config.loadTransforms {
+		if list, err = transform(list); err != nil {
+			return
+		}
+	}
+	if a.config.jsonFields {
+		if list, err = decodeJSONFields(a.entity, list); err != nil {
+			return
+		}
+	}
+	return loadProperties(a.entity, list)
+}
+
+func (a *entityAdapter) Save() (props []datastore.Property, err error) {
+	list, err := a.config.encode(a.entity)
+	if err != nil {
+		return
+	}
+	if max := a.config.maxEntitySize; max > 0 {
+		if size := propertiesSize(list); size > max {
+			return nil, fmt.Errorf("%w: about %d bytes, the limit is %d", ErrEntityTooLarge, size, max)
+		}
+	}
+	return list, nil
+}
+
+// encode returns the properties of entity after the save transforms
+func (config *connectorConfig) encode(entity interface{}) (props datastore.PropertyList, err error) {
+	if props, err = config.properties(entity); err != nil {
+		return
+	}
+	for _, transform := range config.saveTransforms {
+		if props, err = transform(props); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// properties returns the properties of entity with its json fields encoded, before the save
+// transforms
+func (config *connectorConfig) properties(entity interface{}) (props datastore.PropertyList, err error) {
+	if props, err = saveProperties(entity); err != nil {
+		return
+	}
+	// a PropertyList saves itself, the transforms must not change the caller's copy
+	props = append(datastore.PropertyList(nil), props...)
+	if config.jsonFields {
+		props, err = encodeJSONFields(entity, props)
+	}
+	return
+}
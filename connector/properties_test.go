@@ -0,0 +1,81 @@
+package connector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bq/datastore/connector"
+	"github.com/bq/datastore/connector/testutil"
+)
+
+type timedEvent struct {
+	Name string
+	At   time.Time
+}
+
+func TestTimeLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	conn, _, cleanup := testutil.StartEmulator(t, "TimedEvent", connector.WithTimeLocation(loc))
+	defer cleanup()
+
+	// datastore keeps microseconds, the nanoseconds would not survive the round trip
+	at := time.Date(2021, time.March, 28, 1, 30, 0, 123456000, time.FixedZone("UTC-5", -5*3600))
+	if _, err = conn.Save("event", &timedEvent{Name: "event", At: at}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	check := func(method string, got time.Time) {
+		t.Helper()
+		if !got.Equal(at) {
+			t.Errorf("%s: got %v, want the instant %v", method, got, at)
+		}
+		if got.Location() != loc {
+			t.Errorf("%s: got location %v, want %v", method, got.Location(), loc)
+		}
+	}
+
+	var retrieved timedEvent
+	if err = conn.Retrieve("event", &retrieved); err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	check("Retrieve", retrieved.At)
+
+	var queried []timedEvent
+	if err = conn.RetrieveByQuery(&queried, conn.Query()); err != nil {
+		t.Fatalf("RetrieveByQuery: %v", err)
+	}
+	if len(queried) != 1 {
+		t.Fatalf("RetrieveByQuery: got %d events, want 1", len(queried))
+	}
+	check("RetrieveByQuery", queried[0].At)
+
+	var pointers []*timedEvent
+	if err = conn.RetrieveByQuery(&pointers, conn.Query()); err != nil {
+		t.Fatalf("RetrieveByQuery: %v", err)
+	}
+	if len(pointers) != 1 {
+		t.Fatalf("RetrieveByQuery: got %d events, want 1", len(pointers))
+	}
+	check("RetrieveByQuery into pointers", pointers[0].At)
+}
+
+func TestTimeWithoutLocationIsUTC(t *testing.T) {
+	conn, _, cleanup := testutil.StartEmulator(t, "TimedEvent")
+	defer cleanup()
+
+	at := time.Date(2021, time.March, 28, 1, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	if _, err := conn.Save("event", &timedEvent{Name: "event", At: at}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var retrieved timedEvent
+	if err := conn.Retrieve("event", &retrieved); err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if !retrieved.At.Equal(at) || retrieved.At.Location() != time.UTC {
+		t.Errorf("Retrieve: got %v, want %v in UTC", retrieved.At, at)
+	}
+}
@@ -0,0 +1,160 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// QueryOption adjusts a query right before the connector runs it
+type QueryOption func(query *datastore.Query) *datastore.Query
+
+// Distinct returns only distinct results, the query must be a projection query
+func Distinct() QueryOption {
+	return func(query *datastore.Query) *datastore.Query {
+		return query.Distinct()
+	}
+}
+
+// DistinctOn returns only the first result for each combination of the given fields,
+// the fields must be part of the query projection
+func DistinctOn(fieldNames ...string) QueryOption {
+	return func(query *datastore.Query) *datastore.Query {
+		return query.DistinctOn(fieldNames...)
+	}
+}
+
+func applyQueryOptions(query *datastore.Query, opts []QueryOption) *datastore.Query {
+	for _, opt := range opts {
+		query = opt(query)
+	}
+	return query
+}
+
+// RetrieveByQueryPartial runs query into dst, a pointer to a slice, giving up after timeout.
+// When the deadline is hit it keeps the entities read so far and reports partial.
+func (d *datastoreConnector) RetrieveByQueryPartial(dst interface{}, query *datastore.Query, timeout time.Duration) (partial bool, err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	slice := reflect.ValueOf(dst)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return false, fmt.Errorf("connector: dst must be a pointer to a slice, got %T", dst)
+	}
+	slice = slice.Elem()
+
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+
+	it := d.client().Run(ctx, d.prepareQuery(query))
+	for {
+		elem := newElem(slice.Type().Elem())
+		_, err = it.Next(d.adapt(elem.Interface()))
+		if err == iterator.Done {
+			return false, nil
+		}
+		if isDeadlineExceeded(err) {
+			return true, nil
+		}
+		if err != nil {
+			return
+		}
+		appendElem(slice, elem)
+	}
+}
+
+// prepareQuery applies opts and the connector wide query settings to query. A connector set up
+// WithNamespace always queries its namespace, whatever namespace query was built for.
+func (c *connection) prepareQuery(query *datastore.Query, opts ...QueryOption) *datastore.Query {
+	if c.config.namespace != "" {
+		query = query.Namespace(c.config.namespace)
+	}
+	return c.querySettings(query, opts...)
+}
+
+// querySettings applies opts and the connector wide query settings except the namespace, only
+// QueryAcrossNamespaces may leave the connector namespace
+func (c *connection) querySettings(query *datastore.Query, opts ...QueryOption) *datastore.Query {
+	query = applyQueryOptions(query, opts)
+	if c.config.eventualConsistency {
+		query = query.EventualConsistency()
+	}
+	return query
+}
+
+// newElem returns a pointer to load a new element of a []T or []*T slice
+func newElem(elemType reflect.Type) reflect.Value {
+	if elemType.Kind() == reflect.Ptr {
+		return reflect.New(elemType.Elem())
+	}
+	return reflect.New(elemType)
+}
+
+func appendElem(slice, elem reflect.Value) {
+	if slice.Type().Elem().Kind() != reflect.Ptr {
+		elem = elem.Elem()
+	}
+	slice.Set(reflect.Append(slice, elem))
+}
+
+func isDeadlineExceeded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// RetrieveField loads the field property of entityID into dst, a pointer to a value of the
+// property type, with a projection query. The property must be indexed, ErrNotFound is
+// returned when the entity does not exist or has no indexed field property.
+func (d *datastoreConnector) RetrieveField(entityID, field string, dst interface{}) (err error) {
+	defer wrapErr(&err, "retrieve", d.CollectionName, entityID)
+	defer d.track("retrieve", d.CollectionName, entityID)()
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("connector: RetrieveField needs a non nil pointer, got %T", dst)
+	}
+
+	query := d.Query().FilterField("__key__", "=", inboundKey).Project(field).Limit(1)
+	var props datastore.PropertyList
+	if _, err = d.client().Run(d.ctx, d.prepareQuery(query)).Next(d.adapt(&props)); err == iterator.Done {
+		return ErrNotFound
+	} else if err != nil {
+		return
+	}
+
+	for _, prop := range props {
+		if prop.Name != field {
+			continue
+		}
+		value := reflect.ValueOf(prop.Value)
+		if !value.IsValid() {
+			target.Elem().Set(reflect.Zero(target.Elem().Type()))
+			return nil
+		}
+		if !value.Type().ConvertibleTo(target.Elem().Type()) {
+			return fmt.Errorf("connector: %s is a %T, it cannot be loaded into %T", field, prop.Value, dst)
+		}
+		target.Elem().Set(value.Convert(target.Elem().Type()))
+		return nil
+	}
+	return ErrNotFound
+}
+
+// RetrieveModifiedSince appends to dst the entities whose field time is after since, oldest
+// first. The connector does not stamp entities, field must be set by the caller on every save.
+func (d *datastoreConnector) RetrieveModifiedSince(field string, since time.Time, dst interface{}) (err error) {
+	defer wrapErr(&err, "query", d.CollectionName, "")
+	defer d.track("query", d.CollectionName, "")()
+	query := d.Query().FilterField(field, ">", since).Order(field)
+	_, err = d.getAll(d.ctx, d.prepareQuery(query), dst)
+	return
+}
@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// QueryBuilder builds a query on the connector collection and checks it before it is run,
+// the first invalid call is reported by Build
+type QueryBuilder struct {
+	query      *datastore.Query
+	inequality string
+	fields     []string
+	err        error
+}
+
+// Query returns a query on the connector collection and namespace to add filters to
+func (d *datastoreConnector) Query() *datastore.Query {
+	return datastore.NewQuery(d.CollectionName).Namespace(d.config.namespace)
+}
+
+// NewQueryBuilder starts a query on the connector collection and namespace
+func (d *datastoreConnector) NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{query: d.Query()}
+}
+
+// Filter adds a field filter, op is one of =, <, <=, >, >=, !=, in and not-in
+func (b *QueryBuilder) Filter(field, op string, value interface{}) *QueryBuilder {
+	if b.err != nil {
+		return b
+	}
+	if isInequality(op) {
+		if b.inequality != "" && b.inequality != field {
+			b.err = fmt.Errorf("%w: %s %s after an inequality on %s", ErrMultipleInequalities, field, op, b.inequality)
+			return b
+		}
+		b.inequality = field
+	}
+	b.query = b.query.FilterField(field, op, value)
+	b.use(field)
+	return b
+}
+
+// Order sorts the results by field, prefix it with - for descending order
+func (b *QueryBuilder) Order(field string) *QueryBuilder {
+	if b.err == nil {
+		b.query = b.query.Order(field)
+		b.use(strings.TrimPrefix(strings.TrimSpace(field), "-"))
+	}
+	return b
+}
+
+// Limit caps the number of results
+func (b *QueryBuilder) Limit(limit int) *QueryBuilder {
+	if b.err == nil {
+		b.query = b.query.Limit(limit)
+	}
+	return b
+}
+
+// Build returns the query or the first error found while building it
+func (b *QueryBuilder) Build() (*datastore.Query, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.query, nil
+}
+
+// use records that the query filters or sorts on field
+func (b *QueryBuilder) use(field string) {
+	for _, used := range b.fields {
+		if used == field {
+			return
+		}
+	}
+	b.fields = append(b.fields, field)
+}
+
+// CheckExplodingIndex returns ErrExplodingIndex when the query needs a composite index on
+// several list properties of entity, a struct or struct pointer. Such an index gets an entry
+// for every combination of their values, so it grows with the product of the list lengths.
+func (b *QueryBuilder) CheckExplodingIndex(entity interface{}) error {
+	if len(b.fields) < 2 {
+		// a single property query is served by the built-in indexes
+		return nil
+	}
+
+	lists := listProperties(reflect.TypeOf(entity))
+	var exploding []string
+	for _, field := range b.fields {
+		if lists[field] {
+			exploding = append(exploding, field)
+		}
+	}
+	if len(exploding) < 2 {
+		return nil
+	}
+	return fmt.Errorf("%w: the query index would combine the list properties %s", ErrExplodingIndex, strings.Join(exploding, ", "))
+}
+
+// listProperties returns the property names of the slice fields of t, []byte excepted
+func listProperties(t reflect.Type) map[string]bool {
+	lists := make(map[string]bool)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return lists
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("datastore"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if (field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Array) && field.Type.Elem().Kind() != reflect.Uint8 {
+			lists[name] = true
+		}
+	}
+	return lists
+}
+
+func isInequality(op string) bool {
+	switch strings.TrimSpace(op) {
+	case "<", "<=", ">", ">=", "!=", "not-in":
+		return true
+	}
+	return false
+}
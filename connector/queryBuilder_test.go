@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func newTestQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{query: datastore.NewQuery("Item")}
+}
+
+func TestQueryBuilderInequalities(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *QueryBuilder) *QueryBuilder
+		invalid bool
+	}{
+		{name: "equalities", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", "=", 1).Filter("B", "=", 2)
+		}},
+		{name: "range on one property", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", ">=", 1).Filter("A", "<", 5).Filter("B", "=", 2)
+		}},
+		{name: "in is not an inequality", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", ">", 1).Filter("B", "in", []int{1, 2})
+		}},
+		{name: "two properties", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", ">", 1).Filter("B", "<", 2)
+		}, invalid: true},
+		{name: "not equal and not in", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", "!=", 1).Filter("B", "not-in", []int{1})
+		}, invalid: true},
+		{name: "first error kept", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("A", ">", 1).Filter("B", "<", 2).Order("C").Limit(1)
+		}, invalid: true},
+	}
+	for _, test := range tests {
+		query, err := test.build(newTestQueryBuilder()).Build()
+		if test.invalid {
+			if !errors.Is(err, ErrMultipleInequalities) || query != nil {
+				t.Errorf("%s: got %v and error %v, want ErrMultipleInequalities", test.name, query, err)
+			}
+		} else if err != nil || query == nil {
+			t.Errorf("%s: got %v and error %v, want a query", test.name, query, err)
+		}
+	}
+}
+
+type listedItem struct {
+	Tags   []string
+	Owners []string `datastore:"owners"`
+	Hidden []string `datastore:"-"`
+	Data   []byte
+	Name   string
+}
+
+func TestCheckExplodingIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		build     func(b *QueryBuilder) *QueryBuilder
+		exploding bool
+	}{
+		{name: "one list property", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Filter("Tags", "=", "b")
+		}},
+		{name: "list and scalar", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Order("Name")
+		}},
+		{name: "bytes are not a list", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Filter("Data", "=", []byte("x"))
+		}},
+		{name: "unsaved field", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Filter("Hidden", "=", "x")
+		}},
+		{name: "two list properties", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Filter("owners", "=", "bq")
+		}, exploding: true},
+		{name: "filter and descending order", build: func(b *QueryBuilder) *QueryBuilder {
+			return b.Filter("Tags", "=", "a").Order("-owners")
+		}, exploding: true},
+	}
+	for _, test := range tests {
+		b := test.build(newTestQueryBuilder())
+		for _, entity := range []interface{}{listedItem{}, &listedItem{}} {
+			err := b.CheckExplodingIndex(entity)
+			if test.exploding != errors.Is(err, ErrExplodingIndex) {
+				t.Errorf("%s: CheckExplodingIndex(%T) = %v, want exploding %v", test.name, entity, err, test.exploding)
+			}
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"golang.org/x/oauth2"
+)
+
+var (
+	_ DatastoreBasicOpt  = (*Recording)(nil)
+	_ DatastoreAtomicOpt = (*RecordingAtomic)(nil)
+)
+
+// Call is an operation received by a recording connector with its arguments
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the operations received so far, in the order they were called
+func (r *recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Reset forgets the recorded operations
+func (r *recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// Recording is a DatastoreBasicOpt that logs every call before handing it to next, tests can
+// assert on Calls to check which operations their code ran
+type Recording struct {
+	*recorder
+	next DatastoreBasicOpt
+}
+
+// NewRecording records the calls made to next
+func NewRecording(next DatastoreBasicOpt) *Recording {
+	return &Recording{recorder: new(recorder), next: next}
+}
+
+// RecordingAtomic is the DatastoreAtomicOpt counterpart of Recording
+type RecordingAtomic struct {
+	*recorder
+	next DatastoreAtomicOpt
+}
+
+// NewRecordingAtomic records the calls made to next
+func NewRecordingAtomic(next DatastoreAtomicOpt) *RecordingAtomic {
+	return &RecordingAtomic{recorder: new(recorder), next: next}
+}
+
+func (r *Recording) Save(entityID string, entity interface{}) (*datastore.Key, error) {
+	r.record("Save", entityID, entity)
+	return r.next.Save(entityID, entity)
+}
+
+func (r *Recording) SaveEntity(entity interface{}) (*datastore.Key, error) {
+	r.record("SaveEntity", entity)
+	return r.next.SaveEntity(entity)
+}
+
+func (r *Recording) SaveGenerated(entity interface{}) (string, *datastore.Key, error) {
+	r.record("SaveGenerated", entity)
+	return r.next.SaveGenerated(entity)
+}
+
+func (r *Recording) SaveIfVersion(entityID string, entity interface{}, expectedVersion int) (bool, error) {
+	r.record("SaveIfVersion", entityID, entity, expectedVersion)
+	return r.next.SaveIfVersion(entityID, entity, expectedVersion)
+}
+
+func (r *Recording) EstimateSize(entity interface{}) (int, error) {
+	r.record("EstimateSize", entity)
+	return r.next.EstimateSize(entity)
+}
+
+func (r *Recording) SaveAutoID(entity interface{}) (*datastore.Key, error) {
+	r.record("SaveAutoID", entity)
+	return r.next.SaveAutoID(entity)
+}
+
+func (r *Recording) SaveAll(entities map[string]interface{}) ([]*datastore.Key, error) {
+	r.record("SaveAll", entities)
+	return r.next.SaveAll(entities)
+}
+
+func (r *Recording) SaveWithExcludedIndexes(entityID string, entity interface{}, exclude []string) (*datastore.Key, error) {
+	r.record("SaveWithExcludedIndexes", entityID, entity, exclude)
+	return r.next.SaveWithExcludedIndexes(entityID, entity, exclude)
+}
+
+func (r *Recording) SaveMulti(entityIDs []string, entities []interface{}) ([]*datastore.Key, error) {
+	r.record("SaveMulti", entityIDs, entities)
+	return r.next.SaveMulti(entityIDs, entities)
+}
+
+func (r *Recording) SaveProperties(entityID string, props datastore.PropertyList, unindexed []string) (*datastore.Key, error) {
+	r.record("SaveProperties", entityID, props, unindexed)
+	return r.next.SaveProperties(entityID, props, unindexed)
+}
+
+func (r *Recording) SaveBlob(entityID string, data []byte) (*datastore.Key, error) {
+	r.record("SaveBlob", entityID, data)
+	return r.next.SaveBlob(entityID, data)
+}
+
+func (r *Recording) Exist(query *datastore.Query) bool {
+	r.record("Exist", query)
+	return r.next.Exist(query)
+}
+
+func (r *Recording) CountByDay(field string, from, to time.Time) (map[string]int, error) {
+	r.record("CountByDay", field, from, to)
+	return r.next.CountByDay(field, from, to)
+}
+
+func (r *Recording) Delete(entityID string) bool {
+	r.record("Delete", entityID)
+	return r.next.Delete(entityID)
+}
+
+func (r *Recording) DeleteExisting(entityID string) (bool, error) {
+	r.record("DeleteExisting", entityID)
+	return r.next.DeleteExisting(entityID)
+}
+
+func (r *Recording) StreamDelete(query *datastore.Query) (int, error) {
+	r.record("StreamDelete", query)
+	return r.next.StreamDelete(query)
+}
+
+func (r *Recording) DeleteByQueryBounded(query *datastore.Query, maxDuration time.Duration) (int, bool, error) {
+	r.record("DeleteByQueryBounded", query, maxDuration)
+	return r.next.DeleteByQueryBounded(query, maxDuration)
+}
+
+func (r *Recording) Truncate(concurrency int) (int, error) {
+	r.record("Truncate", concurrency)
+	return r.next.Truncate(concurrency)
+}
+
+func (r *Recording) DeleteIf(entityID string, predicate func(dst interface{}) bool) (bool, error) {
+	r.record("DeleteIf", entityID, predicate)
+	return r.next.DeleteIf(entityID, predicate)
+}
+
+func (r *Recording) Update(entityID string, entity interface{}) (*datastore.Key, error) {
+	r.record("Update", entityID, entity)
+	return r.next.Update(entityID, entity)
+}
+
+func (r *Recording) Upsert(entityID string, entity interface{}) (bool, *datastore.Key, error) {
+	r.record("Upsert", entityID, entity)
+	return r.next.Upsert(entityID, entity)
+}
+
+func (r *Recording) Mutate(entityID string, mutate func(dst interface{}) error, dst interface{}) error {
+	r.record("Mutate", entityID, mutate, dst)
+	return r.next.Mutate(entityID, mutate, dst)
+}
+
+func (r *Recording) UpsertMulti(entities map[string]interface{}) (int, int, error) {
+	r.record("UpsertMulti", entities)
+	return r.next.UpsertMulti(entities)
+}
+
+func (r *Recording) SaveAndRetrieve(entityID string, entity interface{}, dst interface{}) error {
+	r.record("SaveAndRetrieve", entityID, entity, dst)
+	return r.next.SaveAndRetrieve(entityID, entity, dst)
+}
+
+func (r *Recording) Retrieve(entityID string, dst interface{}) error {
+	r.record("Retrieve", entityID, dst)
+	return r.next.Retrieve(entityID, dst)
+}
+
+func (r *Recording) RetrieveOrDefault(entityID string, dst interface{}, def interface{}) error {
+	r.record("RetrieveOrDefault", entityID, dst, def)
+	return r.next.RetrieveOrDefault(entityID, dst, def)
+}
+
+func (r *Recording) RetrieveWithRepair(entityID string, dst interface{}, repair func(dst interface{}) (bool, error)) error {
+	r.record("RetrieveWithRepair", entityID, dst, repair)
+	return r.next.RetrieveWithRepair(entityID, dst, repair)
+}
+
+func (r *Recording) RetrieveField(entityID, field string, dst interface{}) error {
+	r.record("RetrieveField", entityID, field, dst)
+	return r.next.RetrieveField(entityID, field, dst)
+}
+
+func (r *Recording) RetrieveBlob(entityID string) ([]byte, error) {
+	r.record("RetrieveBlob", entityID)
+	return r.next.RetrieveBlob(entityID)
+}
+
+func (r *Recording) RetrieveOrdered(entityIDs []string, dst interface{}, onMissing func(id string)) error {
+	r.record("RetrieveOrdered", entityIDs, dst, onMissing)
+	return r.next.RetrieveOrdered(entityIDs, dst, onMissing)
+}
+
+func (r *Recording) Resolve(refs []string, targetKind string, dst interface{}) error {
+	r.record("Resolve", refs, targetKind, dst)
+	return r.next.Resolve(refs, targetKind, dst)
+}
+
+func (r *Recording) RetrieveByKeys(keys []*datastore.Key, dst interface{}) error {
+	r.record("RetrieveByKeys", keys, dst)
+	return r.next.RetrieveByKeys(keys, dst)
+}
+
+func (r *Recording) RetrieveByKeysWhere(keys []*datastore.Key, query *datastore.Query, dst interface{}) error {
+	r.record("RetrieveByKeysWhere", keys, query, dst)
+	return r.next.RetrieveByKeysWhere(keys, query, dst)
+}
+
+func (r *Recording) QueryKeysRaw(query *datastore.Query) ([]*datastore.Key, error) {
+	r.record("QueryKeysRaw", query)
+	return r.next.QueryKeysRaw(query)
+}
+
+func (r *Recording) DeleteKeys(keys []*datastore.Key) error {
+	r.record("DeleteKeys", keys)
+	return r.next.DeleteKeys(keys)
+}
+
+func (r *Recording) UpdateKeys(keys []*datastore.Key, update func(key *datastore.Key, entity *datastore.PropertyList) error) error {
+	r.record("UpdateKeys", keys, update)
+	return r.next.UpdateKeys(keys, update)
+}
+
+func (r *Recording) Query() *datastore.Query {
+	r.record("Query")
+	return r.next.Query()
+}
+
+func (r *Recording) NewQueryBuilder() *QueryBuilder {
+	r.record("NewQueryBuilder")
+	return r.next.NewQueryBuilder()
+}
+
+func (r *Recording) Explain(query *datastore.Query) (ExplainMetrics, error) {
+	r.record("Explain", query)
+	return r.next.Explain(query)
+}
+
+func (r *Recording) RetrieveByQuery(dst interface{}, query *datastore.Query, opts ...QueryOption) error {
+	r.record("RetrieveByQuery", dst, query, opts)
+	return r.next.RetrieveByQuery(dst, query, opts...)
+}
+
+func (r *Recording) RetrieveByQueryWithKeys(dst interface{}, query *datastore.Query, opts ...QueryOption) ([]*datastore.Key, error) {
+	r.record("RetrieveByQueryWithKeys", dst, query, opts)
+	return r.next.RetrieveByQueryWithKeys(dst, query, opts...)
+}
+
+func (r *Recording) RetrieveModifiedSince(field string, since time.Time, dst interface{}) error {
+	r.record("RetrieveModifiedSince", field, since, dst)
+	return r.next.RetrieveModifiedSince(field, since, dst)
+}
+
+func (r *Recording) RetrieveByQueryPartial(dst interface{}, query *datastore.Query, timeout time.Duration) (bool, error) {
+	r.record("RetrieveByQueryPartial", dst, query, timeout)
+	return r.next.RetrieveByQueryPartial(dst, query, timeout)
+}
+
+func (r *Recording) FindOne(query *datastore.Query, dst interface{}) error {
+	r.record("FindOne", query, dst)
+	return r.next.FindOne(query, dst)
+}
+
+func (r *Recording) QueryInto(query *datastore.Query, sliceType reflect.Type) (interface{}, error) {
+	r.record("QueryInto", query, sliceType)
+	return r.next.QueryInto(query, sliceType)
+}
+
+func (r *Recording) QueryToMap(query *datastore.Query, dst interface{}) error {
+	r.record("QueryToMap", query, dst)
+	return r.next.QueryToMap(query, dst)
+}
+
+func (r *Recording) QueryAcrossNamespaces(namespaces []string, query *datastore.Query, dst interface{}) error {
+	r.record("QueryAcrossNamespaces", namespaces, query, dst)
+	return r.next.QueryAcrossNamespaces(namespaces, query, dst)
+}
+
+func (r *Recording) Stream(ctx context.Context, query *datastore.Query) (<-chan Result, <-chan error) {
+	r.record("Stream", ctx, query)
+	return r.next.Stream(ctx, query)
+}
+
+func (r *Recording) StreamWithCancel(query *datastore.Query) (<-chan Result, <-chan error, func()) {
+	r.record("StreamWithCancel", query)
+	return r.next.StreamWithCancel(query)
+}
+
+func (r *Recording) StreamJSON(ctx context.Context, query *datastore.Query, w io.Writer) error {
+	r.record("StreamJSON", ctx, query, w)
+	return r.next.StreamJSON(ctx, query, w)
+}
+
+func (r *Recording) ReadInto(ctx context.Context, query *datastore.Query, out chan<- interface{}, decode func() interface{}) error {
+	r.record("ReadInto", ctx, query, out, decode)
+	return r.next.ReadInto(ctx, query, out, decode)
+}
+
+func (r *Recording) NewBatchWriter(flushSize int, flushInterval time.Duration) *BatchWriter {
+	r.record("NewBatchWriter", flushSize, flushInterval)
+	return r.next.NewBatchWriter(flushSize, flushInterval)
+}
+
+func (r *Recording) ImportRecords(records []Record) ([]ImportResult, error) {
+	r.record("ImportRecords", records)
+	return r.next.ImportRecords(records)
+}
+
+func (r *Recording) ListIDs() ([]string, error) {
+	r.record("ListIDs")
+	return r.next.ListIDs()
+}
+
+func (r *Recording) Properties() ([]string, error) {
+	r.record("Properties")
+	return r.next.Properties()
+}
+
+func (r *Recording) CopyTo(targetKind string, transform func(dst interface{}) interface{}) (int, error) {
+	r.record("CopyTo", targetKind, transform)
+	return r.next.CopyTo(targetKind, transform)
+}
+
+func (r *Recording) Scan(cursor string, batchSize int, fn func(key *datastore.Key, decode func(dst interface{}) error) error, opts ...ScanOption) (string, bool, error) {
+	r.record("Scan", cursor, batchSize, fn, opts)
+	return r.next.Scan(cursor, batchSize, fn, opts...)
+}
+
+func (r *Recording) Transaction(f func(tx *Tx) error) error {
+	r.record("Transaction", f)
+	return r.next.Transaction(f)
+}
+
+func (r *Recording) ReadOnlyTransaction(f func(tx *datastore.Transaction) error) error {
+	r.record("ReadOnlyTransaction", f)
+	return r.next.ReadOnlyTransaction(f)
+}
+
+func (r *Recording) AncestorKey(ancestors []KeyPart) *datastore.Key {
+	r.record("AncestorKey", ancestors)
+	return r.next.AncestorKey(ancestors)
+}
+
+func (r *Recording) SaveWithAncestors(ancestors []KeyPart, entityID string, entity interface{}) (*datastore.Key, error) {
+	r.record("SaveWithAncestors", ancestors, entityID, entity)
+	return r.next.SaveWithAncestors(ancestors, entityID, entity)
+}
+
+func (r *Recording) RetrieveWithAncestors(ancestors []KeyPart, entityID string, dst interface{}) error {
+	r.record("RetrieveWithAncestors", ancestors, entityID, dst)
+	return r.next.RetrieveWithAncestors(ancestors, entityID, dst)
+}
+
+func (r *Recording) DeleteWithAncestors(ancestors []KeyPart, entityID string) error {
+	r.record("DeleteWithAncestors", ancestors, entityID)
+	return r.next.DeleteWithAncestors(ancestors, entityID)
+}
+
+func (r *Recording) QueryWithAncestor(ancestor *datastore.Key, query *datastore.Query, dst interface{}) error {
+	r.record("QueryWithAncestor", ancestor, query, dst)
+	return r.next.QueryWithAncestor(ancestor, query, dst)
+}
+
+func (r *Recording) Warmup(ctx context.Context) error {
+	r.record("Warmup", ctx)
+	return r.next.Warmup(ctx)
+}
+
+func (r *Recording) WaitForEmulator(ctx context.Context, timeout time.Duration) error {
+	r.record("WaitForEmulator", ctx, timeout)
+	return r.next.WaitForEmulator(ctx, timeout)
+}
+
+func (r *Recording) HotKeys(threshold float64) []string {
+	r.record("HotKeys", threshold)
+	return r.next.HotKeys(threshold)
+}
+
+func (r *Recording) Reconnect() error {
+	r.record("Reconnect")
+	return r.next.Reconnect()
+}
+
+func (r *Recording) SetCredentials(ts oauth2.TokenSource) error {
+	r.record("SetCredentials", ts)
+	return r.next.SetCredentials(ts)
+}
+
+func (r *Recording) IsEmulator() bool {
+	r.record("IsEmulator")
+	return r.next.IsEmulator()
+}
+
+func (r *Recording) ComposeID(parts ...string) (string, error) {
+	r.record("ComposeID", parts)
+	return r.next.ComposeID(parts...)
+}
+
+func (r *Recording) ParseID(entityID string) []string {
+	r.record("ParseID", entityID)
+	return r.next.ParseID(entityID)
+}
+
+// Labeled wraps the labeled connector in a Recording logging its calls along with those of r
+func (r *Recording) Labeled(labels map[string]string) DatastoreBasicOpt {
+	r.record("Labeled", labels)
+	return &Recording{recorder: r.recorder, next: r.next.Labeled(labels)}
+}
+
+func (r *RecordingAtomic) Count(entityID string) (int, error) {
+	r.record("Count", entityID)
+	return r.next.Count(entityID)
+}
+
+func (r *RecordingAtomic) HotKeys(threshold float64) []string {
+	r.record("HotKeys", threshold)
+	return r.next.HotKeys(threshold)
+}
+
+func (r *RecordingAtomic) CountMultiOrZero(entityIDs []string) (map[string]int, error) {
+	r.record("CountMultiOrZero", entityIDs)
+	return r.next.CountMultiOrZero(entityIDs)
+}
+
+func (r *RecordingAtomic) DecrementCounter(entityID string, decrementAmount int) (bool, error) {
+	r.record("DecrementCounter", entityID, decrementAmount)
+	return r.next.DecrementCounter(entityID, decrementAmount)
+}
+
+func (r *RecordingAtomic) InitCounter(entityID string, initial int) (bool, error) {
+	r.record("InitCounter", entityID, initial)
+	return r.next.InitCounter(entityID, initial)
+}
+
+func (r *RecordingAtomic) IncrementCounter(entityID string, incrementAmount int) (bool, error) {
+	r.record("IncrementCounter", entityID, incrementAmount)
+	return r.next.IncrementCounter(entityID, incrementAmount)
+}
+
+func (r *RecordingAtomic) IncrementCounterMulti(increments map[string]int) error {
+	r.record("IncrementCounterMulti", increments)
+	return r.next.IncrementCounterMulti(increments)
+}
+
+func (r *RecordingAtomic) IncrementCounterApprox(entityID string, incrementAmount int) error {
+	r.record("IncrementCounterApprox", entityID, incrementAmount)
+	return r.next.IncrementCounterApprox(entityID, incrementAmount)
+}
+
+func (r *RecordingAtomic) IncrementCounterIfBelow(entityID string, incrementAmount, limit int) (bool, int, error) {
+	r.record("IncrementCounterIfBelow", entityID, incrementAmount, limit)
+	return r.next.IncrementCounterIfBelow(entityID, incrementAmount, limit)
+}
+
+func (r *RecordingAtomic) TransferCounter(fromID, toID string, amount int) (bool, error) {
+	r.record("TransferCounter", fromID, toID, amount)
+	return r.next.TransferCounter(fromID, toID, amount)
+}
+
+func (r *RecordingAtomic) IncrementTimeBucket(name string, t time.Time, g Granularity, loc *time.Location, incrementAmount int) (bool, error) {
+	r.record("IncrementTimeBucket", name, t, g, loc, incrementAmount)
+	return r.next.IncrementTimeBucket(name, t, g, loc, incrementAmount)
+}
+
+func (r *RecordingAtomic) Warmup(ctx context.Context) error {
+	r.record("Warmup", ctx)
+	return r.next.Warmup(ctx)
+}
+
+func (r *RecordingAtomic) WaitForEmulator(ctx context.Context, timeout time.Duration) error {
+	r.record("WaitForEmulator", ctx, timeout)
+	return r.next.WaitForEmulator(ctx, timeout)
+}
+
+func (r *RecordingAtomic) Reconnect() error {
+	r.record("Reconnect")
+	return r.next.Reconnect()
+}
+
+func (r *RecordingAtomic) SetCredentials(ts oauth2.TokenSource) error {
+	r.record("SetCredentials", ts)
+	return r.next.SetCredentials(ts)
+}
+
+func (r *RecordingAtomic) IsEmulator() bool {
+	r.record("IsEmulator")
+	return r.next.IsEmulator()
+}
+
+func (r *RecordingAtomic) ComposeID(parts ...string) (string, error) {
+	r.record("ComposeID", parts)
+	return r.next.ComposeID(parts...)
+}
+
+func (r *RecordingAtomic) ParseID(entityID string) []string {
+	r.record("ParseID", entityID)
+	return r.next.ParseID(entityID)
+}
@@ -0,0 +1,41 @@
+package connector
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxRetryAttempts = 3
+	retryBackoff     = 100 * time.Millisecond
+)
+
+// isTransient reports whether err is a temporary datastore failure worth retrying
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
+
+// retryable applies the policy set with WithRetryPolicy to the ImportRecords batches,
+// isTransient by default
+func (c *connection) retryable(err error) bool {
+	if c.config.retryPolicy != nil {
+		return c.config.retryPolicy(err)
+	}
+	return isTransient(err)
+}
+
+// backoff waits before the next attempt, it gives up early if the connector context is done
+func (c *connection) backoff(attempt int) error {
+	select {
+	case <-time.After(time.Duration(attempt) * retryBackoff):
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
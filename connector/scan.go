@@ -0,0 +1,168 @@
+package connector
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+const defaultScanBatchSize = 500
+
+// checkpointKind is the kind of the entities keeping the cursors of WithCheckpointKey scans
+const checkpointKind = "ScanCheckpoint"
+
+// ScanOption configures a Scan call
+type ScanOption func(config *scanConfig)
+
+type scanConfig struct {
+	checkpointID string
+}
+
+// scanCheckpoint is the stored state of a WithCheckpointKey scan
+type scanCheckpoint struct {
+	Kind    string
+	Cursor  string `datastore:",noindex"`
+	Updated time.Time
+}
+
+// WithCheckpointKey stores the scan cursor in the ScanCheckpoint entity named id after every
+// batch, so a scan called with an empty cursor resumes where the previous process stopped.
+// The checkpoint is deleted once the scan is done. A batch interrupted before its checkpoint is
+// stored is read again, fn must cope with seeing some entities twice.
+func WithCheckpointKey(id string) ScanOption {
+	return func(config *scanConfig) {
+		config.checkpointID = id
+	}
+}
+
+// Scan reads the next batch of up to batchSize entities of the collection starting at
+// cursor, an empty cursor starts from the beginning. fn gets every key with a decode func
+// to load the entity. The returned cursor can be stored to resume the scan later on, done
+// is true once the whole collection has been read.
+func (d *datastoreConnector) Scan(cursor string, batchSize int, fn func(key *datastore.Key, decode func(dst interface{}) error) error, opts ...ScanOption) (nextCursor string, done bool, err error) {
+	defer wrapErr(&err, "scan", d.CollectionName, "")
+	defer d.track("scan", d.CollectionName, "")()
+	if batchSize <= 0 {
+		batchSize = defaultScanBatchSize
+	}
+
+	var config scanConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var checkpointKey *datastore.Key
+	if config.checkpointID != "" {
+		if checkpointKey, err = d.validKey(checkpointKind, config.checkpointID); err != nil {
+			return
+		}
+		if cursor == "" {
+			var checkpoint scanCheckpoint
+			if err = d.client().Get(d.ctx, checkpointKey, &checkpoint); err != nil && err != datastore.ErrNoSuchEntity {
+				return
+			}
+			cursor, err = checkpoint.Cursor, nil
+		}
+	}
+
+	query := d.Query().Limit(batchSize)
+	if cursor != "" {
+		start, err := datastore.DecodeCursor(cursor)
+		if err != nil {
+			return "", false, err
+		}
+		query = query.Start(start)
+	}
+
+	it := d.client().Run(d.ctx, d.prepareQuery(query))
+	read := 0
+	for {
+		var props datastore.PropertyList
+		key, err := it.Next(&props)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		read++
+		if err = fn(key, d.propertiesDecoder(props)); err != nil {
+			return "", false, err
+		}
+	}
+
+	next, err := it.Cursor()
+	if err != nil {
+		return
+	}
+	nextCursor, done = next.String(), read < batchSize
+
+	if checkpointKey != nil {
+		if done {
+			err = d.client().Delete(d.ctx, checkpointKey)
+		} else {
+			_, err = d.client().Put(d.ctx, checkpointKey, &scanCheckpoint{Kind: d.CollectionName, Cursor: nextCursor, Updated: time.Now()})
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	return
+}
+
+// CopyTo copies every entity of the collection to targetKind keeping their keys. transform
+// gets each entity as a *datastore.PropertyList and returns the entity to write, nil skips it.
+// A nil transform copies the entities as they are.
+func (d *datastoreConnector) CopyTo(targetKind string, transform func(dst interface{}) interface{}) (copied int, err error) {
+	defer wrapErr(&err, "copy", d.CollectionName, "")
+	defer d.track("copy", d.CollectionName, "")()
+	var keys []*datastore.Key
+	var entities []interface{}
+	flush := func() (err error) {
+		if len(keys) == 0 {
+			return
+		}
+		release := d.acquire()
+		if _, err = d.client().PutMulti(d.ctx, keys, entities); err == nil {
+			copied += len(keys)
+			d.wrote(keys...)
+		}
+		release()
+		keys, entities = nil, nil
+		return
+	}
+
+	it := d.client().Run(d.ctx, d.prepareQuery(d.Query()))
+	for {
+		props := new(datastore.PropertyList)
+		key, err := it.Next(props)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return copied, err
+		}
+
+		var entity interface{} = props
+		if transform != nil {
+			if entity = transform(props); entity == nil {
+				continue
+			}
+		}
+
+		target := *key
+		target.Kind = targetKind
+		keys = append(keys, &target)
+		entities = append(entities, entity)
+		if len(keys) == maxBatchSize {
+			if err = flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+
+	err = flush()
+	return
+}
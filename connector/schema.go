@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"sort"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// propertiesSampleSize is the number of entities read when no statistics are available
+const propertiesSampleSize = 100
+
+// Properties returns the sorted property names of the collection. They are read from the
+// datastore statistics, which are updated about once a day and are not kept by the emulator,
+// when there are none the names are taken from a sample of entities.
+func (d *datastoreConnector) Properties() (names []string, err error) {
+	defer wrapErr(&err, "properties", d.CollectionName, "")
+	defer d.track("properties", d.CollectionName, "")()
+
+	statKind := "__Stat_PropertyName_Kind__"
+	if d.config.namespace != "" {
+		statKind = "__Stat_Ns_PropertyName_Kind__"
+	}
+	stats := datastore.NewQuery(statKind).Namespace(d.config.namespace).FilterField("kind_name", "=", d.CollectionName)
+	seen := make(map[string]bool)
+	if err = d.collectProperties(stats, seen, "property_name"); err != nil {
+		return
+	}
+
+	if len(seen) == 0 {
+		sample := d.Query().Limit(propertiesSampleSize)
+		if err = d.collectProperties(sample, seen, ""); err != nil {
+			return
+		}
+	}
+
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// collectProperties adds to seen the value of the field property of every result or,
+// with an empty field, the name of all their properties
+func (d *datastoreConnector) collectProperties(query *datastore.Query, seen map[string]bool, field string) error {
+	it := d.client().Run(d.ctx, d.prepareQuery(query))
+	for {
+		var props datastore.PropertyList
+		_, err := it.Next(&props)
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, prop := range props {
+			if field == "" {
+				seen[prop.Name] = true
+			} else if name, ok := prop.Value.(string); ok && prop.Name == field {
+				seen[name] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// Result is an entity read by Stream, Decode loads it into a struct pointer or a PropertyLoadSaver
+type Result struct {
+	Key    *datastore.Key
+	Decode func(dst interface{}) error
+}
+
+// Stream runs query and sends every result to the returned channel, which is closed once the
+// query is done or either ctx or the connector context is cancelled. The error channel gets
+// at most one error and is closed after the results channel.
+func (d *datastoreConnector) Stream(ctx context.Context, query *datastore.Query) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errc := make(chan error, 1)
+	ctx, cancel := d.operationContext(ctx)
+
+	go func() {
+		defer cancel()
+		defer close(errc)
+		defer close(results)
+		defer d.track("stream", d.CollectionName, "")()
+
+		it := d.client().Run(ctx, d.prepareQuery(query))
+		for {
+			var props datastore.PropertyList
+			key, err := it.Next(&props)
+			if err == iterator.Done {
+				return
+			}
+			if err != nil {
+				wrapErr(&err, "stream", d.CollectionName, "")
+				errc <- err
+				return
+			}
+
+			select {
+			case results <- Result{Key: key, Decode: d.propertiesDecoder(props)}:
+			case <-ctx.Done():
+				err = ctx.Err()
+				wrapErr(&err, "stream", d.CollectionName, "")
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	return results, errc
+}
+
+// ReadInto runs query and sends every result to out, loaded into a new destination returned by
+// decode, e.g. func() interface{} { return new(Order) }. Sends block while out is full, so the
+// query is read no faster than the consumers drain it. ReadInto returns once the query is done
+// or either ctx or the connector context is cancelled and leaves out open, the caller closes it.
+func (d *datastoreConnector) ReadInto(ctx context.Context, query *datastore.Query, out chan<- interface{}, decode func() interface{}) (err error) {
+	defer wrapErr(&err, "read", d.CollectionName, "")
+	defer d.track("read", d.CollectionName, "")()
+	ctx, cancel := d.operationContext(ctx)
+	defer cancel()
+	it := d.client().Run(ctx, d.prepareQuery(query))
+	for {
+		dst := decode()
+		if _, err = it.Next(d.adapt(dst)); err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+
+		select {
+		case out <- dst:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// operationContext returns a context done as soon as ctx or the connector context is done,
+// cancel must be called to release it
+func (c *connection) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// StreamWithCancel is Stream on the connector context with a cancel func that stops the
+// query, e.g. from an admin endpoint, the error channel then reports the cancellation.
+// cancel must also be called once the stream is done to release its context.
+func (d *datastoreConnector) StreamWithCancel(query *datastore.Query) (results <-chan Result, errc <-chan error, cancel func()) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	results, errc = d.Stream(ctx, query)
+	return
+}
+
+// StreamJSON runs query and writes every result to w as it is read, one JSON object per line.
+// The object holds the entity properties, the entity id under "__key__", nested entities as
+// objects and keys as their id. Writers with a Flush method, like http.ResponseWriter through
+// http.Flusher, are flushed after every line. It stops when either ctx or the connector
+// context is cancelled.
+func (d *datastoreConnector) StreamJSON(ctx context.Context, query *datastore.Query, w io.Writer) (err error) {
+	defer wrapErr(&err, "stream", d.CollectionName, "")
+	defer d.track("stream", d.CollectionName, "")()
+	ctx, cancel := d.operationContext(ctx)
+	defer cancel()
+	flusher, _ := w.(interface{ Flush() })
+	encoder := json.NewEncoder(w)
+
+	it := d.client().Run(ctx, d.prepareQuery(query))
+	for {
+		var props datastore.PropertyList
+		key, err := it.Next(d.adapt(&props))
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		object := jsonObject(props)
+		object["__key__"] = keyID(key)
+		if err = encoder.Encode(object); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// jsonObject converts props to values encoding/json can marshal
+func jsonObject(props []datastore.Property) map[string]interface{} {
+	object := make(map[string]interface{}, len(props)+1)
+	for _, prop := range props {
+		object[prop.Name] = jsonValue(prop.Value)
+	}
+	return object
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *datastore.Entity:
+		if v == nil {
+			return nil
+		}
+		return jsonObject(v.Properties)
+	case *datastore.Key:
+		if v == nil {
+			return nil
+		}
+		return keyID(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i := range v {
+			values[i] = jsonValue(v[i])
+		}
+		return values
+	}
+	return value
+}
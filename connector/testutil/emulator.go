@@ -0,0 +1,78 @@
+// Package testutil starts a datastore emulator for the integration tests of the connector
+// users. It needs the gcloud CLI with the datastore emulator component installed.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/bq/datastore/connector"
+)
+
+// emulatorStartTimeout is how long StartEmulator waits for the emulator to answer
+const emulatorStartTimeout = 60 * time.Second
+
+// EmulatorProjectID is the project the emulator is started with
+const EmulatorProjectID = "connector-test"
+
+// StartEmulator starts an in-memory datastore emulator on a free local port and returns a
+// connector on collectionName wired to it once the emulator is ready. addr can build more
+// connectors with connector.New(true, addr, "", EmulatorProjectID, ...), e.g. atomic ones.
+// cleanup stops the emulator. The test is skipped when gcloud is not installed.
+func StartEmulator(t *testing.T, collectionName string, opts ...connector.Option) (conn connector.DatastoreBasicOpt, addr string, cleanup func()) {
+	t.Helper()
+	gcloud, err := exec.LookPath("gcloud")
+	if err != nil {
+		t.Skip("testutil: gcloud is not installed, skipping datastore emulator test")
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatalf("testutil: find a free port: %v", err)
+	}
+	addr = fmt.Sprintf("localhost:%d", port)
+
+	cmd := exec.Command(gcloud, "beta", "emulators", "datastore", "start",
+		"--no-store-on-disk",
+		"--consistency=1.0",
+		"--project="+EmulatorProjectID,
+		"--host-port="+addr,
+	)
+	if err = cmd.Start(); err != nil {
+		t.Fatalf("testutil: start datastore emulator: %v", err)
+	}
+
+	stop := func() {
+		// the emulator runs in a child java process, asking it to shut down stops both
+		if resp, err := http.Post("http://"+addr+"/shutdown", "text/plain", nil); err == nil {
+			resp.Body.Close()
+		} else {
+			cmd.Process.Kill()
+		}
+		cmd.Wait()
+	}
+
+	conn = connector.New(true, addr, "", EmulatorProjectID, collectionName, opts...)
+	if err = conn.WaitForEmulator(context.Background(), emulatorStartTimeout); err != nil {
+		stop()
+		t.Fatalf("testutil: datastore emulator not ready: %v", err)
+	}
+
+	cleanup = stop
+	return
+}
+
+func freePort() (port int, err error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return
+	}
+	port = l.Addr().(*net.TCPAddr).Port
+	err = l.Close()
+	return
+}
@@ -0,0 +1,89 @@
+package connector
+
+import (
+	"fmt"
+	"time"
+)
+
+// Granularity is the size of the time buckets used by IncrementTimeBucket
+type Granularity int
+
+const (
+	// HOURLY ...
+	HOURLY Granularity = 1 + iota
+	// DAILY ...
+	DAILY
+)
+
+var granularity = [...]string{
+	"HOURLY",
+	"DAILY",
+}
+
+var granularityLayout = [...]string{
+	"2006-01-02T15",
+	"2006-01-02",
+}
+
+func (g Granularity) String() string {
+	if !g.valid() {
+		return fmt.Sprintf("Granularity(%d)", int(g))
+	}
+	return granularity[g-1]
+}
+
+// valid reports whether g is one of the declared granularities, the zero value is not
+func (g Granularity) valid() bool {
+	return g >= HOURLY && int(g) <= len(granularityLayout)
+}
+
+// BucketID returns the counter id of name for the bucket t falls in, e.g. views:2024-06-01T14.
+// Buckets follow the wall clock of loc, UTC when loc is nil, so days start at local midnight
+// across DST changes. When clocks go back the repeated hour shares its hourly bucket.
+func BucketID(name string, t time.Time, g Granularity, loc *time.Location) (string, error) {
+	if !g.valid() {
+		return "", fmt.Errorf("%w: %v", ErrInvalidGranularity, g)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return name + ":" + t.In(loc).Format(granularityLayout[g-1]), nil
+}
+
+// IncrementTimeBucket increments the name counter of the time bucket t falls in
+func (d *datastoreAtomicConnector) IncrementTimeBucket(name string, t time.Time, g Granularity, loc *time.Location, incrementAmount int) (bool, error) {
+	counterID, err := BucketID(name, t, g, loc)
+	if err != nil {
+		return false, err
+	}
+	return d.IncrementCounter(counterID, incrementAmount)
+}
+
+// CountByDay counts the entities whose field time is in [from, to) for every day of the range,
+// keyed like 2024-06-01. Days follow the wall clock of the from location, days without
+// entities count 0.
+func (d *datastoreConnector) CountByDay(field string, from, to time.Time) (counts map[string]int, err error) {
+	defer wrapErr(&err, "count", d.CollectionName, "")
+	defer d.track("count", d.CollectionName, "")()
+	counts = make(map[string]int)
+	y, m, day := from.Date()
+	for start := time.Date(y, m, day, 0, 0, 0, 0, from.Location()); start.Before(to); start = start.AddDate(0, 0, 1) {
+		low, high := start, start.AddDate(0, 0, 1)
+		if low.Before(from) {
+			low = from
+		}
+		if high.After(to) {
+			high = to
+		}
+
+		query := d.Query().
+			FilterField(field, ">=", low).
+			FilterField(field, "<", high)
+		amount, err := d.client().Count(d.ctx, d.prepareQuery(query))
+		if err != nil {
+			return nil, err
+		}
+		counts[start.Format(granularityLayout[DAILY-1])] = amount
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBucketID(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	at := time.Date(2024, time.June, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		g    Granularity
+		loc  *time.Location
+		want string
+	}{
+		{g: HOURLY, want: "views:2024-06-01T23"},
+		{g: DAILY, want: "views:2024-06-01"},
+		{g: HOURLY, loc: madrid, want: "views:2024-06-02T01"},
+		{g: DAILY, loc: madrid, want: "views:2024-06-02"},
+	}
+	for _, test := range tests {
+		got, err := BucketID("views", at, test.g, test.loc)
+		if err != nil || got != test.want {
+			t.Errorf("BucketID(%v, %v): got %q and error %v, want %q", test.g, test.loc, got, err, test.want)
+		}
+	}
+}
+
+func TestBucketIDInvalidGranularity(t *testing.T) {
+	for _, g := range []Granularity{0, DAILY + 1, -1} {
+		if got, err := BucketID("views", time.Now(), g, nil); !errors.Is(err, ErrInvalidGranularity) {
+			t.Errorf("BucketID(%d): got %q and error %v, want ErrInvalidGranularity", int(g), got, err)
+		}
+	}
+}
+
+func TestGranularityString(t *testing.T) {
+	tests := []struct {
+		g    Granularity
+		want string
+	}{
+		{g: HOURLY, want: "HOURLY"},
+		{g: DAILY, want: "DAILY"},
+		{g: 0, want: "Granularity(0)"},
+		{g: DAILY + 1, want: "Granularity(3)"},
+	}
+	for _, test := range tests {
+		if got := test.g.String(); got != test.want {
+			t.Errorf("Granularity(%d).String(): got %q, want %q", int(test.g), got, test.want)
+		}
+	}
+}
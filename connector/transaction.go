@@ -0,0 +1,98 @@
+package connector
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// maxEntityGroups is the maximum number of entity groups a datastore transaction can touch
+const maxEntityGroups = 25
+
+// Tx is a transaction on the connector collection, it keeps count of the entity groups it
+// touches and fails with ErrTooManyEntityGroups before datastore rejects the commit
+type Tx struct {
+	d      *datastoreConnector
+	t      *datastore.Transaction
+	groups map[datastore.Key]bool
+	puts   []*datastore.Key
+}
+
+// Transaction runs f in a transaction that is committed when f returns nil.
+// A transaction touches at most 25 entity groups, the work must be split in several
+// transactions or the entities nested under a common ancestor to go beyond that.
+// The datastore client does not return the commit time, entities that need a server side
+// ordering have to carry their own timestamp property.
+func (d *datastoreConnector) Transaction(f func(tx *Tx) error) (err error) {
+	defer wrapErr(&err, "transaction", d.CollectionName, "")
+	defer d.track("transaction", d.CollectionName, "")()
+	var tx *Tx
+	_, err = d.runInTransaction(func(t *datastore.Transaction) error {
+		tx = &Tx{d: d, t: t, groups: make(map[datastore.Key]bool)}
+		return f(tx)
+	})
+	if err == nil {
+		d.wrote(tx.puts...)
+	}
+	return
+}
+
+// Get loads entityID into dst, it returns ErrNotFound when the entity does not exist
+func (tx *Tx) Get(entityID string, dst interface{}) (err error) {
+	key, err := tx.key(entityID)
+	if err != nil {
+		return
+	}
+	if err = tx.t.Get(key, tx.d.adapt(dst)); err == datastore.ErrNoSuchEntity {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Put saves entity as entityID when the transaction commits
+func (tx *Tx) Put(entityID string, entity interface{}) (err error) {
+	key, err := tx.key(entityID)
+	if err != nil {
+		return
+	}
+	if _, err = tx.t.Put(key, tx.d.adapt(entity)); err == nil {
+		tx.puts = append(tx.puts, key)
+	}
+	return
+}
+
+// Delete removes entityID when the transaction commits
+func (tx *Tx) Delete(entityID string) (err error) {
+	key, err := tx.key(entityID)
+	if err != nil {
+		return
+	}
+	err = tx.t.Delete(key)
+	return
+}
+
+func (tx *Tx) key(entityID string) (key *datastore.Key, err error) {
+	defer wrapErr(&err, "transaction", tx.d.CollectionName, entityID)
+	if key, err = tx.d.validKey(tx.d.CollectionName, entityID); err != nil {
+		return
+	}
+	err = tx.touch(key)
+	return
+}
+
+// touch records the entity group of key
+func (tx *Tx) touch(key *datastore.Key) error {
+	root := *key
+	for root.Parent != nil {
+		root = *root.Parent
+	}
+	if tx.groups[root] {
+		return nil
+	}
+	if len(tx.groups) == maxEntityGroups {
+		return fmt.Errorf("%w: a transaction can touch %d of them, split the work in smaller transactions",
+			ErrTooManyEntityGroups, maxEntityGroups)
+	}
+	tx.groups[root] = true
+	return nil
+}
@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// splitOversampling is the number of __scatter__ keys read for every split point kept
+const splitOversampling = 32
+
+// Truncate deletes every entity of the collection, splitting the keys in up to concurrency
+// ranges deleted in parallel. The ranges come from the __scatter__ sampling of datastore, so
+// they are only roughly even. Every batch delete holds a slot of the WithMaxConcurrency limit.
+// deleted counts the entities removed before an error.
+func (d *datastoreConnector) Truncate(concurrency int) (deleted int, err error) {
+	defer wrapErr(&err, "truncate", d.CollectionName, "")
+	defer d.track("truncate", d.CollectionName, "")()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	splits, err := d.splitPoints(concurrency - 1)
+	if err != nil {
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i <= len(splits); i++ {
+		query := d.Query()
+		if i > 0 {
+			query = query.FilterField("__key__", ">=", splits[i-1])
+		}
+		if i < len(splits) {
+			query = query.FilterField("__key__", "<", splits[i])
+		}
+
+		wg.Add(1)
+		go func(query *datastore.Query) {
+			defer wg.Done()
+			n, _, rangeErr := d.deleteByQuery(query, time.Time{})
+			mu.Lock()
+			defer mu.Unlock()
+			deleted += n
+			if err == nil {
+				err = rangeErr
+			}
+		}(query)
+	}
+	wg.Wait()
+	return
+}
+
+// splitPoints returns up to n sorted keys that split the collection in ranges of about the
+// same size
+func (d *datastoreConnector) splitPoints(n int) (splits []*datastore.Key, err error) {
+	if n == 0 {
+		return
+	}
+	query := d.Query().Order("__scatter__").KeysOnly().Limit(n * splitOversampling)
+	sample, err := d.client().GetAll(d.ctx, query, nil)
+	if err != nil {
+		return
+	}
+
+	sort.Slice(sample, func(i, j int) bool { return keyLess(sample[i], sample[j]) })
+	step := len(sample) / (n + 1)
+	if step == 0 {
+		return sample, nil
+	}
+	for i := step; i < len(sample) && len(splits) < n; i += step {
+		splits = append(splits, sample[i])
+	}
+	return
+}
+
+// keyLess orders keys as datastore does, by path from the root with ids before names
+func keyLess(a, b *datastore.Key) bool {
+	pa, pb := keyPath(a), keyPath(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, y := pa[i], pb[i]
+		switch {
+		case x.Kind != y.Kind:
+			return x.Kind < y.Kind
+		case (x.Name == "") != (y.Name == ""):
+			return x.Name == ""
+		case x.Name != y.Name:
+			return x.Name < y.Name
+		case x.ID != y.ID:
+			return x.ID < y.ID
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+func keyPath(key *datastore.Key) (path []*datastore.Key) {
+	for k := key; k != nil; k = k.Parent {
+		path = append([]*datastore.Key{k}, path...)
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestKeyLess(t *testing.T) {
+	org := datastore.NameKey("Org", "bq", nil)
+	tests := []struct {
+		name string
+		a, b *datastore.Key
+		want bool
+	}{
+		{name: "kind", a: datastore.NameKey("A", "z", nil), b: datastore.NameKey("B", "a", nil), want: true},
+		{name: "name", a: datastore.NameKey("A", "a", nil), b: datastore.NameKey("A", "b", nil), want: true},
+		{name: "name reversed", a: datastore.NameKey("A", "b", nil), b: datastore.NameKey("A", "a", nil), want: false},
+		{name: "id", a: datastore.IDKey("A", 1, nil), b: datastore.IDKey("A", 2, nil), want: true},
+		{name: "id before name", a: datastore.IDKey("A", 9, nil), b: datastore.NameKey("A", "a", nil), want: true},
+		{name: "name after id", a: datastore.NameKey("A", "a", nil), b: datastore.IDKey("A", 9, nil), want: false},
+		{name: "parent before child", a: org, b: datastore.NameKey("User", "a", org), want: true},
+		{name: "child after parent", a: datastore.NameKey("User", "a", org), b: org, want: false},
+		{name: "parent order first", a: datastore.NameKey("User", "z", datastore.NameKey("Org", "a", nil)), b: datastore.NameKey("User", "a", org), want: true},
+		{name: "equal", a: datastore.NameKey("A", "a", nil), b: datastore.NameKey("A", "a", nil), want: false},
+	}
+	for _, test := range tests {
+		if got := keyLess(test.a, test.b); got != test.want {
+			t.Errorf("%s: keyLess(%v, %v) = %v, want %v", test.name, test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// versionField is the integer field SaveIfVersion compares and increments when no field is
+// tagged `connector:"version"`
+const versionField = "Version"
+
+// SaveIfVersion saves entity, a struct pointer with an integer version field, only when the
+// stored version still equals expectedVersion, a missing entity has version 0. The version
+// field is the one tagged `connector:"version"`, or else the Version field, its property is
+// named by its datastore tag. On a match the field is set to expectedVersion+1 before entity
+// is written in the same transaction. saved is false, and nothing is written, when another
+// writer changed the entity meanwhile.
+func (d *datastoreConnector) SaveIfVersion(entityID string, entity interface{}, expectedVersion int) (saved bool, err error) {
+	defer wrapErr(&err, "save", d.CollectionName, entityID)
+	defer d.track("save", d.CollectionName, entityID)()
+	version, property, err := versionOf(entity)
+	if err != nil {
+		return
+	}
+	inboundKey, err := d.validKey(d.CollectionName, entityID)
+	if err != nil {
+		return
+	}
+
+	previous := version.Int()
+	_, err = d.runInTransaction(func(t *datastore.Transaction) (err error) {
+		var stored datastore.PropertyList
+		if err = t.Get(inboundKey, &stored); err != nil && err != datastore.ErrNoSuchEntity {
+			return
+		}
+		err = nil
+
+		var storedVersion int64
+		for _, prop := range stored {
+			if prop.Name == property {
+				storedVersion, _ = prop.Value.(int64)
+			}
+		}
+		if saved = storedVersion == int64(expectedVersion); !saved {
+			return
+		}
+
+		version.SetInt(int64(expectedVersion) + 1)
+		_, err = t.Put(inboundKey, d.adapt(entity))
+		return
+	})
+
+	if err != nil {
+		saved = false
+	}
+	if saved {
+		d.wrote(inboundKey)
+	} else {
+		version.SetInt(previous)
+	}
+
+	return
+}
+
+// versionOf returns the settable version field of entity and the name of its property
+func versionOf(entity interface{}) (version reflect.Value, property string, err error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return version, "", fmt.Errorf("connector: SaveIfVersion needs a struct pointer, got %T", entity)
+	}
+
+	v = v.Elem()
+	field, found := reflect.StructField{}, false
+	for i := 0; i < v.NumField() && !found; i++ {
+		if field = v.Type().Field(i); hasTagOption(field.Tag.Get(connectorTag), "version") {
+			found = true
+		}
+	}
+	if !found {
+		if field, found = v.Type().FieldByName(versionField); !found {
+			return version, "", fmt.Errorf("connector: %T has no version field", entity)
+		}
+	}
+
+	if property = strings.Split(field.Tag.Get("datastore"), ",")[0]; property == "-" {
+		return version, "", fmt.Errorf("connector: version field %s of %T is not saved", field.Name, entity)
+	} else if property == "" {
+		property = field.Name
+	}
+
+	version = v.FieldByIndex(field.Index)
+	switch version.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return version, property, nil
+	}
+	return reflect.Value{}, "", fmt.Errorf("connector: version field %s of %T is not an integer", field.Name, entity)
+}
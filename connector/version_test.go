@@ -0,0 +1,56 @@
+package connector
+
+import "testing"
+
+type versioned struct {
+	Name    string
+	Version int
+}
+
+type taggedVersion struct {
+	Version  int
+	Revision int64 `datastore:"rev" connector:"version"`
+}
+
+type unsavedVersion struct {
+	Version int `datastore:"-"`
+}
+
+type textVersion struct {
+	Version string
+}
+
+func TestVersionOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		entity   interface{}
+		property string
+		invalid  bool
+	}{
+		{name: "Version field", entity: &versioned{}, property: "Version"},
+		{name: "tagged field", entity: &taggedVersion{}, property: "rev"},
+		{name: "not a pointer", entity: versioned{}, invalid: true},
+		{name: "no version field", entity: &struct{ Name string }{}, invalid: true},
+		{name: "not saved", entity: &unsavedVersion{}, invalid: true},
+		{name: "not an integer", entity: &textVersion{}, invalid: true},
+	}
+	for _, test := range tests {
+		version, property, err := versionOf(test.entity)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: got property %q, want an error", test.name, property)
+			}
+			continue
+		}
+		if err != nil || property != test.property || !version.CanSet() {
+			t.Errorf("%s: got property %q and error %v, want %q settable", test.name, property, err, test.property)
+		}
+	}
+
+	entity := &taggedVersion{}
+	version, _, _ := versionOf(entity)
+	version.SetInt(3)
+	if entity.Revision != 3 || entity.Version != 0 {
+		t.Errorf("got %+v, want the tagged field set", entity)
+	}
+}